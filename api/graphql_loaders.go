@@ -99,9 +99,14 @@ func NewBelongsToAssocLoader(coll *db.Collection, assocType interface{}) *datalo
 
 		var results []*dataloader.Result
 		for _, key := range keys {
-			val := m.MapIndex(reflect.ValueOf(key))
+			// Keys without a row, such as empty IDs, resolve to null
+			var data interface{}
+			if val := m.MapIndex(reflect.ValueOf(key)); val.IsValid() {
+				data = val.Interface()
+			}
+
 			results = append(results, &dataloader.Result{
-				Data: val.Interface(),
+				Data: data,
 			})
 		}
 
@@ -9,7 +9,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cjlucas/tenor/date"
 	"github.com/cjlucas/tenor/db"
+	"github.com/cjlucas/tenor/scanner"
 	"github.com/nicksrandall/dataloader"
 )
 
@@ -35,13 +37,22 @@ type collectionResolver struct {
 	Type             interface{}
 	SortableFields   []string
 	DefaultSortField string
+	YearField        string
+	// LibraryRootFilter is a condition, with a placeholder for the
+	// root's ID, matching rows within a library root
+	LibraryRootFilter string
+	CompilationField  string
 
 	// Parameters
-	First      int    `args:"first"`
-	Before     string `args:"before"`
-	After      string `args:"after"`
-	OrderBy    string `args:"orderBy"`
-	Descending bool   `args:"descending"`
+	First       int    `args:"first"`
+	Before      string `args:"before"`
+	After       string `args:"after"`
+	OrderBy     string `args:"orderBy"`
+	Descending  bool   `args:"descending"`
+	Year        int    `args:"year"`
+	LibraryRoot string `args:"libraryRoot"`
+	// Compilation is nil if not filtering by it
+	Compilation *bool `args:"isCompilation"`
 }
 
 func (r *collectionResolver) validSortableField() bool {
@@ -125,6 +136,40 @@ func (r *collectionResolver) Resolve(ctx context.Context) (*Connection, error) {
 
 	query = query.Order(r.OrderBy, r.Descending).Order("id", false)
 
+	if r.Year != 0 {
+		if r.YearField == "" {
+			return nil, errors.New("filtering by year is not supported")
+		}
+
+		// Partial dates are stored at the start of their period, so a year
+		// range matches every precision. Undated rows are excluded explicitly.
+		start := time.Date(r.Year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		query = query.Where(
+			r.YearField+"_precision > ? AND "+r.YearField+" >= ? AND "+r.YearField+" < ?",
+			date.None, start, start.AddDate(1, 0, 0))
+	}
+
+	if r.LibraryRoot != "" {
+		if r.LibraryRootFilter == "" {
+			return nil, errors.New("filtering by library root is not supported")
+		}
+
+		query = query.Where(r.LibraryRootFilter, r.LibraryRoot)
+	}
+
+	if r.Compilation != nil {
+		if r.CompilationField == "" {
+			return nil, errors.New("filtering by compilation is not supported")
+		}
+
+		if *r.Compilation {
+			query = query.Where(r.CompilationField+" = ?", true)
+		} else {
+			// Rows from before compilations were detected are NULL
+			query = query.Where(r.CompilationField+" IS NULL OR "+r.CompilationField+" = ?", false)
+		}
+	}
+
 	if r.After != "" {
 		cursor, err := r.decodeCursor(r.After)
 		if err != nil {
@@ -207,6 +252,25 @@ func (r *belongsToAssocResolver) Resolve(ctx context.Context, source interface{}
 	return r.Loader.Load(ctx, field.Interface().(string))()
 }
 
+// imageFieldResolver resolves a field of the source's image, or null if
+// it has no image.
+type imageFieldResolver struct {
+	FieldName string
+
+	Loader *dataloader.Loader
+}
+
+func (r *imageFieldResolver) Resolve(ctx context.Context, source interface{}) (interface{}, error) {
+	assoc := &belongsToAssocResolver{FieldName: "ImageID", Loader: r.Loader}
+
+	image, err := assoc.Resolve(ctx, source)
+	if err != nil || image == nil {
+		return nil, err
+	}
+
+	return reflect.Indirect(reflect.ValueOf(image)).FieldByName(r.FieldName).Interface(), nil
+}
+
 type idLookupResolver struct {
 	Collection *db.Collection
 	Type       interface{}
@@ -226,6 +290,261 @@ func (r *idLookupResolver) Resolve(ctx context.Context) (interface{}, error) {
 	return val, err
 }
 
+// mergeResolver merges the Source row into the Target row and
+// returns the Target.
+type mergeResolver struct {
+	Collection *db.Collection
+	Type       interface{}
+	MergeFunc  func(sourceID, targetID string) error
+
+	Source string `args:"source"`
+	Target string `args:"target"`
+}
+
+func (r *mergeResolver) Resolve(ctx context.Context) (interface{}, error) {
+	if err := r.MergeFunc(r.Source, r.Target); err != nil {
+		return nil, err
+	}
+
+	val := reflect.New(reflect.TypeOf(r.Type)).Interface()
+	err := r.Collection.ByID(r.Target, val)
+
+	return val, err
+}
+
+// rescanTrack loads the track and forces its file to be rescanned so
+// changes to its overrides are applied.
+func rescanTrack(dal *db.DB, scannerService *scanner.Service, id string) (*db.Track, error) {
+	var track db.Track
+	if err := dal.Tracks.Preload("File").ByID(id, &track); err != nil {
+		return nil, err
+	}
+
+	if track.File != nil {
+		scannerService.RescanFile(track.File.Path)
+	}
+
+	return &track, nil
+}
+
+// setTrackFieldResolver overrides a field of a track's tags. The track is
+// returned as is, the override is applied once its file is rescanned.
+type setTrackFieldResolver struct {
+	DB             *db.DB
+	ScannerService *scanner.Service
+
+	ID    string `args:"id"`
+	Field string `args:"field"`
+	Value string `args:"value"`
+}
+
+func (r *setTrackFieldResolver) Resolve(ctx context.Context) (*db.Track, error) {
+	if err := scanner.ValidateOverride(r.Field, r.Value); err != nil {
+		return nil, err
+	}
+
+	var track db.Track
+	if err := r.DB.Tracks.ByID(r.ID, &track); err != nil {
+		return nil, err
+	}
+
+	override := db.Override{TrackID: track.ID, Field: r.Field}
+	if err := r.DB.Overrides.FirstOrCreate(&override); err != nil {
+		return nil, err
+	}
+
+	override.Value = r.Value
+	if err := r.DB.Overrides.Update(&override); err != nil {
+		return nil, err
+	}
+
+	return rescanTrack(r.DB, r.ScannerService, track.ID)
+}
+
+// clearOverrideResolver reverts a field of a track to the value from its tags.
+type clearOverrideResolver struct {
+	DB             *db.DB
+	ScannerService *scanner.Service
+
+	ID    string `args:"id"`
+	Field string `args:"field"`
+}
+
+func (r *clearOverrideResolver) Resolve(ctx context.Context) (*db.Track, error) {
+	err := r.DB.Exec("DELETE FROM overrides WHERE track_id = ? AND field = ?", r.ID, r.Field)
+	if err != nil {
+		return nil, err
+	}
+
+	return rescanTrack(r.DB, r.ScannerService, r.ID)
+}
+
+// rescanAlbum queues the files of the album's tracks to be rescanned.
+func rescanAlbum(dal *db.DB, scannerService *scanner.Service, id string) (*db.Album, error) {
+	var album db.Album
+	if err := dal.Albums.ByID(id, &album); err != nil {
+		return nil, err
+	}
+
+	paths, err := albumPaths(dal, album.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fpath := range paths {
+		scannerService.RescanFile(fpath)
+	}
+
+	return &album, nil
+}
+
+func albumPaths(dal *db.DB, albumID string) ([]string, error) {
+	var paths []string
+	err := dal.Files.
+		Where("id IN (SELECT file_id FROM tracks WHERE album_id = ?)", albumID).
+		Pluck("path", &paths)
+
+	return paths, err
+}
+
+// setAlbumFieldResolver overrides a field of the tags of every track of an
+// album. The album is returned as is, the override is applied once its
+// files are rescanned, which may move the tracks to another album if the
+// album's name or artist is overridden.
+type setAlbumFieldResolver struct {
+	DB             *db.DB
+	ScannerService *scanner.Service
+
+	ID    string `args:"id"`
+	Field string `args:"field"`
+	Value string `args:"value"`
+}
+
+func (r *setAlbumFieldResolver) Resolve(ctx context.Context) (*db.Album, error) {
+	if err := scanner.ValidateAlbumOverride(r.Field, r.Value); err != nil {
+		return nil, err
+	}
+
+	var album db.Album
+	if err := r.DB.Albums.ByID(r.ID, &album); err != nil {
+		return nil, err
+	}
+
+	override := db.AlbumOverride{AlbumID: album.ID, Field: r.Field}
+	if err := r.DB.AlbumOverrides.FirstOrCreate(&override); err != nil {
+		return nil, err
+	}
+
+	override.Value = r.Value
+	if err := r.DB.AlbumOverrides.Update(&override); err != nil {
+		return nil, err
+	}
+
+	return rescanAlbum(r.DB, r.ScannerService, album.ID)
+}
+
+// clearAlbumOverrideResolver reverts a field of an album's tracks to the
+// values from their tags.
+type clearAlbumOverrideResolver struct {
+	DB             *db.DB
+	ScannerService *scanner.Service
+
+	ID    string `args:"id"`
+	Field string `args:"field"`
+}
+
+func (r *clearAlbumOverrideResolver) Resolve(ctx context.Context) (*db.Album, error) {
+	err := r.DB.Exec("DELETE FROM album_overrides WHERE album_id = ? AND field = ?", r.ID, r.Field)
+	if err != nil {
+		return nil, err
+	}
+
+	return rescanAlbum(r.DB, r.ScannerService, r.ID)
+}
+
+// scanJobResult returns the job started by a rescan mutation.
+func scanJobResult(scannerService *scanner.Service, id string, err error) (*scanner.Job, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	job, _ := scannerService.Job(id)
+
+	return &job, nil
+}
+
+type rescanPathResolver struct {
+	ScannerService *scanner.Service
+
+	Path string `args:"path"`
+}
+
+func (r *rescanPathResolver) Resolve(ctx context.Context) (*scanner.Job, error) {
+	id, err := r.ScannerService.RescanPaths([]string{r.Path})
+
+	return scanJobResult(r.ScannerService, id, err)
+}
+
+type rescanAlbumResolver struct {
+	DB             *db.DB
+	ScannerService *scanner.Service
+
+	ID string `args:"id"`
+}
+
+func (r *rescanAlbumResolver) Resolve(ctx context.Context) (*scanner.Job, error) {
+	paths, err := albumPaths(r.DB, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, errors.New("album not found")
+	}
+
+	id, err := r.ScannerService.RescanPaths(paths)
+
+	return scanJobResult(r.ScannerService, id, err)
+}
+
+type scanJobResolver struct {
+	ScannerService *scanner.Service
+
+	ID string `args:"id"`
+}
+
+func (r *scanJobResolver) Resolve(ctx context.Context) (*scanner.Job, error) {
+	job, ok := r.ScannerService.Job(r.ID)
+	if !ok {
+		return nil, errors.New("job not found")
+	}
+
+	return &job, nil
+}
+
+type partialDateResolver struct {
+	FieldName string
+}
+
+func (r *partialDateResolver) Resolve(ctx context.Context, source interface{}) (interface{}, error) {
+	val := reflect.ValueOf(source)
+	for val.Kind() == reflect.Ptr {
+		val = reflect.Indirect(val)
+	}
+
+	timeField := val.FieldByName(r.FieldName)
+	precisionField := val.FieldByName(r.FieldName + "Precision")
+
+	if !timeField.IsValid() || !precisionField.IsValid() {
+		return nil, fmt.Errorf("partialDateResolver: %s could not be found in source", r.FieldName)
+	}
+
+	t := timeField.Interface().(time.Time)
+	precision := precisionField.Interface().(date.Precision)
+
+	return date.New(t, precision), nil
+}
+
 type instanceCountResolver struct {
 	Loader *dataloader.Loader
 }
@@ -3,6 +3,7 @@ package api
 import (
 	"time"
 
+	"github.com/cjlucas/tenor/date"
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/graphql/language/ast"
 )
@@ -56,3 +57,52 @@ var dateTime = graphql.NewScalar(graphql.ScalarConfig{
 		return nil
 	},
 })
+
+func serializePartialDate(value interface{}) interface{} {
+	switch value := value.(type) {
+	case date.Date:
+		if value.IsZero() {
+			return nil
+		}
+
+		return value.String()
+	case *date.Date:
+		return serializePartialDate(*value)
+	default:
+		return nil
+	}
+}
+
+func unserializePartialDate(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		d, err := date.Parse(value)
+		if err != nil {
+			return nil
+		}
+
+		return d
+	case *string:
+		return unserializePartialDate(*value)
+	case []byte:
+		return unserializePartialDate(string(value))
+	default:
+		return nil
+	}
+}
+
+var partialDate = graphql.NewScalar(graphql.ScalarConfig{
+	Name: "PartialDate",
+	Description: "The `PartialDate` scalar type represents a calendar date where" +
+		" only some components may be known. It is serialized as a YYYY," +
+		" YYYY-MM or YYYY-MM-DD quoted string",
+	Serialize:  serializePartialDate,
+	ParseValue: unserializePartialDate,
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		switch valueAST := valueAST.(type) {
+		case *ast.StringValue:
+			return valueAST.Value
+		}
+		return nil
+	},
+})
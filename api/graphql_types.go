@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/cjlucas/tenor/db"
+	"github.com/cjlucas/tenor/scanner"
 	"github.com/cjlucas/tenor/search"
 	"github.com/graphql-go/graphql"
 )
@@ -98,6 +99,10 @@ func (o *Object) addFieldsFromModel(modelType reflect.Type, indexPath []int) {
 			output = graphql.Float
 		case time.Time:
 			output = dateTime
+		case bool:
+			output = graphql.Boolean
+		case db.StringList:
+			output = graphql.NewList(graphql.String)
 		}
 
 		if output == nil {
@@ -168,9 +173,21 @@ func (s *Schema) Build(db *db.DB) error {
 		return err
 	}
 
-	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+	config := graphql.SchemaConfig{
 		Query: query,
-	})
+	}
+
+	// GraphQL doesn't allow an object without any fields
+	if len(s.Mutations.Fields) > 0 {
+		mutation, err := s.buildObject(buildCtx, s.Mutations)
+		if err != nil {
+			return err
+		}
+
+		config.Mutation = mutation
+	}
+
+	schema, err := graphql.NewSchema(config)
 
 	if err != nil {
 		return err
@@ -205,7 +222,7 @@ func (s *Schema) buildArgument(resolver interface{}) (graphql.FieldConfigArgumen
 				}
 			case int:
 				input = graphql.Int
-			case bool:
+			case bool, *bool:
 				input = graphql.Boolean
 			default:
 				return nil, errors.New("unknown argument type")
@@ -266,7 +283,14 @@ func (s *Schema) buildResolver(buildCtx *schemaBuildContext, resolver interface{
 					val := reflect.ValueOf(p.Args[name])
 
 					if val.IsValid() {
-						res.Elem().Field(i).Set(val)
+						// Pointer arguments are left nil if they weren't given
+						if fieldVal.Kind() == reflect.Ptr {
+							ptr := reflect.New(fieldVal.Type().Elem())
+							ptr.Elem().Set(val)
+							val = ptr
+						}
+
+						fieldVal.Set(val)
 					}
 				}
 			}
@@ -408,7 +432,7 @@ func (s *Schema) buildObject(buildCtx *schemaBuildContext, object *Object) (*gra
 	return out, nil
 }
 
-func LoadSchema(dal *db.DB, searchService *search.Service) (*Schema, error) {
+func LoadSchema(dal *db.DB, searchService *search.Service, scannerService *scanner.Service) (*Schema, error) {
 	trackObject := NewObjectWithModel("Track", db.Track{})
 
 	discObject := NewObjectWithModel("Disc", db.Disc{})
@@ -439,6 +463,20 @@ func LoadSchema(dal *db.DB, searchService *search.Service) (*Schema, error) {
 		},
 	})
 
+	for _, obj := range []*Object{trackObject, albumObject} {
+		obj.AddField(&Field{
+			Name:     "partialReleaseDate",
+			Type:     partialDate,
+			Resolver: &partialDateResolver{FieldName: "ReleaseDate"},
+		})
+
+		obj.AddField(&Field{
+			Name:     "partialOriginalReleaseDate",
+			Type:     partialDate,
+			Resolver: &partialDateResolver{FieldName: "OriginalReleaseDate"},
+		})
+	}
+
 	artistObject := NewObjectWithModel("Artist", db.Artist{})
 
 	artistObject.AddField(&Field{
@@ -500,6 +538,61 @@ func LoadSchema(dal *db.DB, searchService *search.Service) (*Schema, error) {
 		},
 	})
 
+	creditObject := NewObjectWithModel("Credit", db.TrackCredit{})
+
+	creditObject.AddField(&Field{
+		Name: "artist",
+		Type: artistObject,
+		Resolver: &belongsToAssocResolver{
+			FieldName: "ArtistID",
+			Loader:    NewBelongsToAssocLoader(&dal.Artists.Collection, &db.Artist{}),
+		},
+	})
+
+	trackObject.AddField(&Field{
+		Name: "credits",
+		Type: ListObject{Of: creditObject},
+		Resolver: &hasManyAssocResolver{
+			Loader: NewHasManyAssocLoader(&dal.TrackCredits.Collection, &db.TrackCredit{}, "track_id", "TrackID"),
+		},
+	})
+
+	workObject := NewObjectWithModel("Work", db.Work{})
+
+	workObject.AddField(&Field{
+		Name: "composer",
+		Type: artistObject,
+		Resolver: &belongsToAssocResolver{
+			FieldName: "ArtistID",
+			Loader:    NewBelongsToAssocLoader(&dal.Artists.Collection, &db.Artist{}),
+		},
+	})
+
+	workObject.AddField(&Field{
+		Name: "tracks",
+		Type: ListObject{Of: trackObject},
+		Resolver: &hasManyAssocResolver{
+			Loader: NewHasManyAssocLoader(&dal.Tracks.Collection, &db.Track{}, "work_id", "WorkID"),
+		},
+	})
+
+	artistObject.AddField(&Field{
+		Name: "works",
+		Type: ListObject{Of: workObject},
+		Resolver: &hasManyAssocResolver{
+			Loader: NewHasManyAssocLoader(&dal.Works.Collection, &db.Work{}, "artist_id", "ArtistID"),
+		},
+	})
+
+	trackObject.AddField(&Field{
+		Name: "work",
+		Type: workObject,
+		Resolver: &belongsToAssocResolver{
+			FieldName: "WorkID",
+			Loader:    NewBelongsToAssocLoader(&dal.Works.Collection, &db.Work{}),
+		},
+	})
+
 	trackObject.AddField(&Field{
 		Name: "disc",
 		Type: artistObject,
@@ -509,6 +602,35 @@ func LoadSchema(dal *db.DB, searchService *search.Service) (*Schema, error) {
 		},
 	})
 
+	imageObject := NewObjectWithModel("Image", db.Image{})
+
+	// Shared so an album's image and colors are loaded together
+	imageLoader := NewBelongsToAssocLoader(&dal.Images.Collection, &db.Image{})
+
+	for _, obj := range []*Object{trackObject, albumObject} {
+		obj.AddField(&Field{
+			Name: "image",
+			Type: imageObject,
+			Resolver: &belongsToAssocResolver{
+				FieldName: "ImageID",
+				Loader:    imageLoader,
+			},
+		})
+	}
+
+	for _, name := range []string{"DominantColor", "VibrantColor", "MutedColor"} {
+		albumObject.AddField(&Field{
+			Name: fieldName(name),
+			Type: graphql.String,
+			Resolver: &imageFieldResolver{
+				FieldName: name,
+				Loader:    imageLoader,
+			},
+		})
+	}
+
+	libraryRootObject := NewObjectWithModel("LibraryRoot", db.LibraryRoot{})
+
 	schema := NewSchema()
 
 	schema.AddQuery(&Field{
@@ -555,6 +677,39 @@ func LoadSchema(dal *db.DB, searchService *search.Service) (*Schema, error) {
 			Type:             db.Artist{},
 			SortableFields:   []string{"name"},
 			DefaultSortField: "name",
+			LibraryRootFilter: `id IN (SELECT albums.artist_id FROM albums
+				JOIN tracks ON tracks.album_id = albums.id
+				JOIN files ON files.id = tracks.file_id
+				WHERE files.library_root_id = ?)`,
+		},
+	})
+
+	schema.AddQuery(&Field{
+		Name: "composers",
+		Type: ConnectionObject{Of: artistObject},
+		Resolver: &collectionResolver{
+			Collection:       &dal.Composers.Collection,
+			Type:             db.Artist{},
+			SortableFields:   []string{"name"},
+			DefaultSortField: "name",
+			LibraryRootFilter: `id IN (SELECT track_credits.artist_id FROM track_credits
+				JOIN tracks ON tracks.id = track_credits.track_id
+				JOIN files ON files.id = tracks.file_id
+				WHERE files.library_root_id = ?)`,
+		},
+	})
+
+	schema.AddQuery(&Field{
+		Name: "works",
+		Type: ConnectionObject{Of: workObject},
+		Resolver: &collectionResolver{
+			Collection:       &dal.Works.Collection,
+			Type:             db.Work{},
+			SortableFields:   []string{"name", "created_at"},
+			DefaultSortField: "name",
+			LibraryRootFilter: `id IN (SELECT tracks.work_id FROM tracks
+				JOIN files ON files.id = tracks.file_id
+				WHERE files.library_root_id = ?)`,
 		},
 	})
 
@@ -571,6 +726,21 @@ func LoadSchema(dal *db.DB, searchService *search.Service) (*Schema, error) {
 				"created_at",
 			},
 			DefaultSortField: "name",
+			YearField:        "release_date",
+			CompilationField: "is_compilation",
+			LibraryRootFilter: `id IN (SELECT tracks.album_id FROM tracks
+				JOIN files ON files.id = tracks.file_id
+				WHERE files.library_root_id = ?)`,
+		},
+	})
+
+	schema.AddQuery(&Field{
+		Name: "libraryRoots",
+		Type: ListObject{Of: libraryRootObject},
+		Resolver: func(ctx context.Context) ([]db.LibraryRoot, error) {
+			var roots []db.LibraryRoot
+			err := dal.LibraryRoots.Order("name", false).All(&roots)
+			return roots, err
 		},
 	})
 
@@ -592,6 +762,134 @@ func LoadSchema(dal *db.DB, searchService *search.Service) (*Schema, error) {
 		},
 	})
 
+	providerStatusObject := NewObjectWithModel("ProviderStatus", scanner.ProviderStatus{})
+
+	scanStatusObject := NewObjectWithModel("ScanStatus", scanner.Status{})
+	scanStatusObject.AddField(&Field{
+		Name: "eta",
+		Type: graphql.Int,
+		Resolver: func(ctx context.Context, status *scanner.Status) (int, error) {
+			return int(status.ETA.Seconds()), nil
+		},
+	})
+	scanStatusObject.AddField(&Field{
+		Name: "providers",
+		Type: ListObject{Of: providerStatusObject},
+		Resolver: func(ctx context.Context, status *scanner.Status) ([]scanner.ProviderStatus, error) {
+			return status.Providers, nil
+		},
+	})
+
+	schema.AddQuery(&Field{
+		Name: "scanStatus",
+		Type: scanStatusObject,
+		Resolver: func(ctx context.Context) (*scanner.Status, error) {
+			status := scannerService.Status()
+			return &status, nil
+		},
+	})
+
+	schema.AddMutation(&Field{
+		Name: "mergeArtists",
+		Type: artistObject,
+		Resolver: &mergeResolver{
+			Collection: &dal.Artists.Collection,
+			Type:       db.Artist{},
+			MergeFunc:  dal.MergeArtists,
+		},
+	})
+
+	schema.AddMutation(&Field{
+		Name: "mergeAlbums",
+		Type: albumObject,
+		Resolver: &mergeResolver{
+			Collection: &dal.Albums.Collection,
+			Type:       db.Album{},
+			MergeFunc:  dal.MergeAlbums,
+		},
+	})
+
+	schema.AddMutation(&Field{
+		Name: "setTrackField",
+		Type: trackObject,
+		Resolver: &setTrackFieldResolver{
+			ScannerService: scannerService,
+		},
+	})
+
+	schema.AddMutation(&Field{
+		Name: "clearOverride",
+		Type: trackObject,
+		Resolver: &clearOverrideResolver{
+			ScannerService: scannerService,
+		},
+	})
+
+	schema.AddMutation(&Field{
+		Name: "setAlbumField",
+		Type: albumObject,
+		Resolver: &setAlbumFieldResolver{
+			ScannerService: scannerService,
+		},
+	})
+
+	schema.AddMutation(&Field{
+		Name: "clearAlbumOverride",
+		Type: albumObject,
+		Resolver: &clearAlbumOverrideResolver{
+			ScannerService: scannerService,
+		},
+	})
+
+	scanJobObject := NewObjectWithModel("ScanJob", scanner.Job{})
+
+	schema.AddQuery(&Field{
+		Name: "scanJob",
+		Type: scanJobObject,
+		Resolver: &scanJobResolver{
+			ScannerService: scannerService,
+		},
+	})
+
+	schema.AddMutation(&Field{
+		Name: "rescanLibrary",
+		Type: scanJobObject,
+		Resolver: func(ctx context.Context) (*scanner.Job, error) {
+			id, err := scannerService.RescanLibrary()
+			return scanJobResult(scannerService, id, err)
+		},
+	})
+
+	schema.AddMutation(&Field{
+		Name: "rescanPath",
+		Type: scanJobObject,
+		Resolver: &rescanPathResolver{
+			ScannerService: scannerService,
+		},
+	})
+
+	schema.AddMutation(&Field{
+		Name: "rescanAlbum",
+		Type: scanJobObject,
+		Resolver: &rescanAlbumResolver{
+			ScannerService: scannerService,
+		},
+	})
+
+	gcStatsObject := NewObjectWithModel("GCStats", scanner.GCStats{})
+
+	schema.AddMutation(&Field{
+		Name: "collectGarbage",
+		Type: gcStatsObject,
+		Resolver: func(ctx context.Context) (*scanner.GCStats, error) {
+			stats, err := scannerService.CollectGarbage()
+			if err != nil {
+				return nil, err
+			}
+			return &stats, nil
+		},
+	})
+
 	return schema, schema.Build(dal)
 }
 
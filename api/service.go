@@ -1,30 +1,49 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cjlucas/tenor/artwork"
 	"github.com/cjlucas/tenor/db"
+	"github.com/cjlucas/tenor/scanner"
 	"github.com/cjlucas/tenor/search"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 type Service struct {
-	db            *db.DB
-	artworkStore  *artwork.Store
-	searchService *search.Service
+	db             *db.DB
+	artworkStore   artwork.Store
+	searchService  *search.Service
+	scannerService *scanner.Service
 }
 
-func NewService(db *db.DB, artworkStore *artwork.Store, searchService *search.Service) *Service {
+func NewService(db *db.DB, artworkStore artwork.Store, searchService *search.Service, scannerService *scanner.Service) *Service {
 	return &Service{
-		db:            db,
-		artworkStore:  artworkStore,
-		searchService: searchService,
+		db:             db,
+		artworkStore:   artworkStore,
+		searchService:  searchService,
+		scannerService: scannerService,
 	}
 }
 
-func (s *Service) Run() {
+// imageCacheControl lets clients cache images indefinitely, since an
+// image's content never changes
+const imageCacheControl = "public, max-age=31536000, immutable"
+
+// shutdownTimeout is how long requests are given to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// Run serves the API until ctx is done, then shuts down the server once
+// in-flight requests finish or shutdownTimeout has passed.
+func (s *Service) Run(ctx context.Context) error {
 	router := gin.Default()
 	router.Use(cors.Default())
 
@@ -34,7 +53,7 @@ func (s *Service) Run() {
 
 	router.Static("/static", "dist/static")
 
-	schema, err := LoadSchema(s.db, s.searchService)
+	schema, err := LoadSchema(s.db, s.searchService, s.scannerService)
 	if err != nil {
 		// TODO: remove panic
 		panic(err)
@@ -47,16 +66,97 @@ func (s *Service) Run() {
 		var dbImage db.Image
 		s.db.Images.ByID(id, &dbImage)
 
-		fmt.Println(dbImage)
-
 		if dbImage.ID == "" {
 			c.AbortWithStatus(404)
 			return
 		}
-		c.Header("Content-Type", dbImage.MIMEType)
 
-		fpath := s.artworkStore.ImagePath(dbImage.Checksum)
-		c.File(fpath)
+		// ?size= picks the smallest thumbnail at least that many pixels
+		// on its longest side
+		var size int
+		if sizeParam := c.Query("size"); sizeParam != "" {
+			n, err := strconv.Atoi(sizeParam)
+			if err != nil || n <= 0 {
+				c.AbortWithStatus(400)
+				return
+			}
+			size = artwork.ThumbnailSize(n)
+		}
+
+		// Images are stored by their checksum, so an image ID always
+		// refers to the same content
+		etag := `"` + dbImage.Checksum + `"`
+		if size > 0 {
+			etag = fmt.Sprintf(`"%s-%d"`, dbImage.Checksum, size)
+		}
+
+		cacheControl := imageCacheControl
+
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.Header("ETag", etag)
+			c.Header("Cache-Control", cacheControl)
+			c.AbortWithStatus(304)
+			return
+		}
+
+		contentType := dbImage.MIMEType
+
+		var r io.ReadCloser
+		var err error
+		if size > 0 {
+			r, err = artwork.OpenThumbnail(s.artworkStore, dbImage.Checksum, size)
+			if err == nil {
+				contentType = "image/jpeg"
+			} else if err != artwork.ErrNoThumbnail && err != artwork.ErrNotFound {
+				// The original can't be cached as the thumbnail, which may
+				// be generated by a later request
+				fmt.Println("Error opening thumbnail:", err)
+				etag = `"` + dbImage.Checksum + `"`
+				cacheControl = "no-cache"
+			}
+		}
+
+		// Images no larger than the thumbnail, or whose thumbnail couldn't
+		// be generated, are served as is
+		if r == nil && err != artwork.ErrNotFound {
+			r, err = s.artworkStore.OpenImage(dbImage.Checksum)
+		}
+
+		if err == artwork.ErrNotFound {
+			c.AbortWithStatus(404)
+			return
+		} else if err != nil {
+			fmt.Println("Error opening image:", err)
+			c.AbortWithStatus(500)
+			return
+		}
+		defer r.Close()
+
+		// Caching headers are only sent once the image is known to exist,
+		// so errors aren't cached
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", cacheControl)
+		c.Header("Content-Type", contentType)
+		c.Status(200)
+		io.Copy(c.Writer, r)
+	})
+
+	// Streams the scanner's status as server-sent events
+	router.GET("/scan/status", func(c *gin.Context) {
+		statuses, unsubscribe := s.scannerService.SubscribeStatus()
+		defer unsubscribe()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case status := <-statuses:
+				c.SSEvent("status", scanStatusJSON(status))
+				return true
+			case <-c.Request.Context().Done():
+				return false
+			case <-ctx.Done():
+				return false
+			}
+		})
 	})
 
 	router.GET("/stream/:id", func(c *gin.Context) {
@@ -70,8 +170,71 @@ func (s *Service) Run() {
 			return
 		}
 
-		c.File(track.File.Path)
+		f, err := os.Open(track.File.Path)
+		if err != nil {
+			c.AbortWithStatus(404)
+			return
+		}
+		defer f.Close()
+
+		// ServeContent handles Range and If-Modified-Since requests. The
+		// mtime the file was scanned with is used so Last-Modified
+		// changes along with the track's metadata.
+		http.ServeContent(c.Writer, c.Request, track.File.Path, track.File.MTime, f)
 	})
 
-	router.Run(":4000")
+	server := &http.Server{
+		Addr:    ":4000",
+		Handler: router,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return server.Shutdown(shutdownCtx)
+}
+
+// etagMatches reports whether an If-None-Match header matches etag.
+func etagMatches(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanStatusJSON uses the same field names as the GraphQL ScanStatus type
+func scanStatusJSON(status scanner.Status) gin.H {
+	providers := make([]gin.H, len(status.Providers))
+	for i, p := range status.Providers {
+		providers[i] = gin.H{
+			"name":  p.Name,
+			"state": p.State,
+		}
+	}
+
+	return gin.H{
+		"state":       status.State,
+		"queued":      status.Queued,
+		"processed":   status.Processed,
+		"failed":      status.Failed,
+		"currentPath": status.CurrentPath,
+		"eta":         int(status.ETA.Seconds()),
+		"startedAt":   status.StartedAt,
+		"providers":   providers,
+	}
 }
@@ -0,0 +1,128 @@
+package artwork
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	dirPermissions  = 0755
+	filePermissions = 0644
+)
+
+// thumbnailDir is the directory within RootPath thumbnails are cached in
+const thumbnailDir = "thumbnails"
+
+// FilesystemStore stores images in a directory.
+type FilesystemStore struct {
+	RootPath string
+}
+
+func NewFilesystemStore(rootPath string) *FilesystemStore {
+	return &FilesystemStore{
+		RootPath: rootPath,
+	}
+}
+
+func (s *FilesystemStore) ImagePath(key string) string {
+	return path.Join(s.RootPath, string(key[0]), key)
+}
+
+func (s *FilesystemStore) thumbnailPath(key string, size int) string {
+	return path.Join(s.RootPath, thumbnailDir, string(key[0]), fmt.Sprintf("%s-%d.jpg", key, size))
+}
+
+func (s *FilesystemStore) WriteImage(key string, data []byte) error {
+	return writeFile(s.ImagePath(key), data)
+}
+
+func (s *FilesystemStore) OpenImage(key string) (io.ReadCloser, error) {
+	return openFile(s.ImagePath(key))
+}
+
+func (s *FilesystemStore) DeleteImage(key string) error {
+	for _, size := range ThumbnailSizes {
+		os.Remove(s.thumbnailPath(key, size))
+	}
+
+	return os.Remove(s.ImagePath(key))
+}
+
+func (s *FilesystemStore) Keys() ([]string, error) {
+	var keys []string
+
+	err := filepath.Walk(s.RootPath, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() && fpath == path.Join(s.RootPath, thumbnailDir) {
+			return filepath.SkipDir
+		}
+
+		// Temporary files are left behind by interrupted writes
+		if !info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+			keys = append(keys, info.Name())
+		}
+
+		return nil
+	})
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return keys, err
+}
+
+func (s *FilesystemStore) WriteThumbnail(key string, size int, data []byte) error {
+	return writeFile(s.thumbnailPath(key, size), data)
+}
+
+func (s *FilesystemStore) OpenThumbnail(key string, size int) (io.ReadCloser, error) {
+	return openFile(s.thumbnailPath(key, size))
+}
+
+func openFile(fpath string) (io.ReadCloser, error) {
+	f, err := os.Open(fpath)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return f, err
+}
+
+// writeFile writes data to a temporary file that's moved into place, so
+// readers never see a partially written file.
+func writeFile(fpath string, data []byte) error {
+	dir := filepath.Dir(fpath)
+	if err := os.MkdirAll(dir, dirPermissions); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), filePermissions)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fpath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
@@ -0,0 +1,197 @@
+package artwork
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// Palette holds colors picked from an image as hex strings, e.g. "#1a2b3c".
+type Palette struct {
+	// Dominant is the most common color
+	Dominant string
+	// Vibrant is a saturated color suitable for accents
+	Vibrant string
+	// Muted is a desaturated color suitable for backgrounds
+	Muted string
+}
+
+// paletteSize is the number of colors the image is reduced to before
+// picking the palette's colors from them
+const paletteSize = 8
+
+// paletteSampleSize is the size the image is scaled to before it's sampled
+const paletteSampleSize = 64
+
+type paletteColor struct {
+	R, G, B    uint8
+	Population int
+}
+
+func (c paletteColor) hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// hsl returns the color's saturation and lightness, from 0 to 1.
+func (c paletteColor) hsl() (float64, float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+
+	max, min := r, r
+	for _, v := range []float64{g, b} {
+		if v > max {
+			max = v
+		}
+		if v < min {
+			min = v
+		}
+	}
+
+	l := (max + min) / 2
+	if max == min {
+		return 0, l
+	}
+
+	d := max - min
+	if l > 0.5 {
+		return d / (2 - max - min), l
+	}
+	return d / (max + min), l
+}
+
+// ExtractPalette picks a palette from img by reducing it to a few colors
+// with median cut.
+func ExtractPalette(img image.Image) Palette {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return Palette{}
+	}
+
+	sample := img
+	if bounds.Dx() > paletteSampleSize || bounds.Dy() > paletteSampleSize {
+		sample = resize(img, paletteSampleSize)
+	}
+
+	sb := sample.Bounds()
+	pixels := make([][3]uint8, 0, sb.Dx()*sb.Dy())
+	for y := sb.Min.Y; y < sb.Max.Y; y++ {
+		for x := sb.Min.X; x < sb.Max.X; x++ {
+			r, g, b, a := sample.At(x, y).RGBA()
+			// Mostly transparent pixels aren't part of the artwork
+			if a < 0x8000 {
+				continue
+			}
+			pixels = append(pixels, [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)})
+		}
+	}
+
+	colors := medianCut(pixels, paletteSize)
+	if len(colors) == 0 {
+		return Palette{}
+	}
+
+	sort.Slice(colors, func(i, j int) bool {
+		return colors[i].Population > colors[j].Population
+	})
+
+	var vibrant, muted *paletteColor
+	var vibrantScore, mutedScore float64
+	for i := range colors {
+		c := &colors[i]
+		s, l := c.hsl()
+
+		// Favor colors that are neither too dark nor too light
+		if l < 0.2 || l > 0.85 {
+			continue
+		}
+
+		if score := s * float64(c.Population); s >= 0.35 && score > vibrantScore {
+			vibrant, vibrantScore = c, score
+		}
+
+		if score := (1 - s) * float64(c.Population); s < 0.35 && score > mutedScore {
+			muted, mutedScore = c, score
+		}
+	}
+
+	palette := Palette{Dominant: colors[0].hex()}
+
+	palette.Vibrant = palette.Dominant
+	if vibrant != nil {
+		palette.Vibrant = vibrant.hex()
+	}
+
+	palette.Muted = palette.Dominant
+	if muted != nil {
+		palette.Muted = muted.hex()
+	}
+
+	return palette
+}
+
+// medianCut reduces pixels to at most n colors by repeatedly splitting the
+// box of pixels with the widest channel at its median.
+func medianCut(pixels [][3]uint8, n int) []paletteColor {
+	if len(pixels) == 0 {
+		return nil
+	}
+
+	boxes := [][][3]uint8{pixels}
+	for len(boxes) < n {
+		// Find the box with the widest range in any channel
+		best, bestChannel, bestRange := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+
+			for ch := 0; ch < 3; ch++ {
+				lo, hi := box[0][ch], box[0][ch]
+				for _, p := range box {
+					if p[ch] < lo {
+						lo = p[ch]
+					}
+					if p[ch] > hi {
+						hi = p[ch]
+					}
+				}
+
+				if int(hi-lo) > bestRange {
+					best, bestChannel, bestRange = i, ch, int(hi-lo)
+				}
+			}
+		}
+
+		// Every box is a single color
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.Slice(box, func(i, j int) bool {
+			return box[i][bestChannel] < box[j][bestChannel]
+		})
+
+		mid := len(box) / 2
+		boxes[best] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	colors := make([]paletteColor, len(boxes))
+	for i, box := range boxes {
+		var r, g, b int
+		for _, p := range box {
+			r += int(p[0])
+			g += int(p[1])
+			b += int(p[2])
+		}
+
+		colors[i] = paletteColor{
+			R:          uint8(r / len(box)),
+			G:          uint8(g / len(box)),
+			B:          uint8(b / len(box)),
+			Population: len(box),
+		}
+	}
+
+	return colors
+}
@@ -0,0 +1,132 @@
+package artwork
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go"
+)
+
+type S3Config struct {
+	// Endpoint is the host and port of the server, e.g. localhost:9000
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Secure    bool
+
+	Bucket string
+	// Prefix is prepended to every object name
+	Prefix string
+}
+
+// S3Store stores images in a bucket of an S3-compatible server, such as
+// MinIO.
+type S3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Store connects to the server and creates the bucket if it doesn't
+// exist.
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	client, err := minio.New(cfg.Endpoint, cfg.AccessKey, cfg.SecretKey, cfg.Secure)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		if err := client.MakeBucket(cfg.Bucket, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3Store{
+		client: client,
+		bucket: cfg.Bucket,
+		prefix: strings.Trim(cfg.Prefix, "/"),
+	}, nil
+}
+
+func (s *S3Store) imageName(key string) string {
+	return path.Join(s.prefix, "images", key)
+}
+
+func (s *S3Store) thumbnailName(key string, size int) string {
+	return path.Join(s.prefix, thumbnailDir, fmt.Sprintf("%s-%d.jpg", key, size))
+}
+
+func (s *S3Store) WriteImage(key string, data []byte) error {
+	return s.put(s.imageName(key), data, "")
+}
+
+func (s *S3Store) OpenImage(key string) (io.ReadCloser, error) {
+	return s.get(s.imageName(key))
+}
+
+func (s *S3Store) DeleteImage(key string) error {
+	for _, size := range ThumbnailSizes {
+		s.client.RemoveObject(s.bucket, s.thumbnailName(key, size))
+	}
+
+	return s.client.RemoveObject(s.bucket, s.imageName(key))
+}
+
+func (s *S3Store) Keys() ([]string, error) {
+	done := make(chan struct{})
+	defer close(done)
+
+	var keys []string
+	for obj := range s.client.ListObjectsV2(s.bucket, s.imageName("")+"/", true, done) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+
+		keys = append(keys, path.Base(obj.Key))
+	}
+
+	return keys, nil
+}
+
+func (s *S3Store) WriteThumbnail(key string, size int, data []byte) error {
+	return s.put(s.thumbnailName(key, size), data, "image/jpeg")
+}
+
+func (s *S3Store) OpenThumbnail(key string, size int) (io.ReadCloser, error) {
+	return s.get(s.thumbnailName(key, size))
+}
+
+func (s *S3Store) put(name string, data []byte, contentType string) error {
+	opts := minio.PutObjectOptions{ContentType: contentType}
+	_, err := s.client.PutObject(s.bucket, name, bytes.NewReader(data), int64(len(data)), opts)
+
+	return err
+}
+
+func (s *S3Store) get(name string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Objects are fetched lazily, so missing objects are only found once
+	// they're used
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return obj, nil
+}
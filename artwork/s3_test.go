@@ -0,0 +1,108 @@
+package artwork
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+// TestS3Store runs against a real S3-compatible server, such as a local
+// MinIO started with
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//
+// It's skipped unless TENOR_S3_TEST_ENDPOINT is set, e.g. to
+// localhost:9000. TENOR_S3_TEST_ACCESS_KEY and TENOR_S3_TEST_SECRET_KEY
+// default to MinIO's minioadmin credentials, and TENOR_S3_TEST_BUCKET to
+// tenor-test. Objects are written under a prefix unique to each run.
+func TestS3Store(t *testing.T) {
+	endpoint := os.Getenv("TENOR_S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("TENOR_S3_TEST_ENDPOINT is not set")
+	}
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:  endpoint,
+		AccessKey: getenv("TENOR_S3_TEST_ACCESS_KEY", "minioadmin"),
+		SecretKey: getenv("TENOR_S3_TEST_SECRET_KEY", "minioadmin"),
+		Bucket:    getenv("TENOR_S3_TEST_BUCKET", "tenor-test"),
+		Prefix:    fmt.Sprintf("test-%d", time.Now().UnixNano()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "tenor-artwork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	images := map[string]string{
+		"0123456789abcdef": "first image",
+		"fedcba9876543210": "second image",
+	}
+
+	src := NewFilesystemStore(dir)
+	for key, data := range images {
+		if err := src.WriteImage(key, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := Copy(store, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(images) {
+		t.Errorf("Copy copied %d images, want %d", n, len(images))
+	}
+
+	for key, want := range images {
+		data, err := ReadImage(store, key)
+		if err != nil {
+			t.Fatalf("OpenImage(%s): %s", key, err)
+		}
+		if string(data) != want {
+			t.Errorf("OpenImage(%s) = %q, want %q", key, data, want)
+		}
+	}
+
+	keys, err := store.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "0123456789abcdef" || keys[1] != "fedcba9876543210" {
+		t.Errorf("Keys() = %v", keys)
+	}
+
+	for key := range images {
+		if err := store.DeleteImage(key); err != nil {
+			t.Fatalf("DeleteImage(%s): %s", key, err)
+		}
+
+		if _, err := store.OpenImage(key); err != ErrNotFound {
+			t.Errorf("OpenImage(%s) after DeleteImage returned %v, want ErrNotFound", key, err)
+		}
+	}
+
+	keys, err = store.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Keys() after DeleteImage = %v", keys)
+	}
+}
+
+func getenv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
@@ -1,40 +1,127 @@
 package artwork
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
-	"path"
-	"path/filepath"
+	"strings"
 )
 
-const permissions = 0755
+// ErrNotFound is returned when an image or thumbnail isn't in the store.
+var ErrNotFound = errors.New("image not found")
 
-type Store struct {
-	RootPath string
+// Store saves images by key, along with thumbnails of them. Keys are the
+// MD5 checksums of the images.
+type Store interface {
+	WriteImage(key string, data []byte) error
+	OpenImage(key string) (io.ReadCloser, error)
+	// DeleteImage deletes the image and its thumbnails
+	DeleteImage(key string) error
+	// Keys returns the keys of all images in the store.
+	Keys() ([]string, error)
+
+	WriteThumbnail(key string, size int, data []byte) error
+	OpenThumbnail(key string, size int) (io.ReadCloser, error)
 }
 
-func NewStore(rootPath string) *Store {
-	return &Store{
-		RootPath: rootPath,
+// OpenStore opens the store at uri. Images are stored in a directory
+// unless uri is of the form
+//
+//	s3://ACCESS_KEY:SECRET_KEY@HOST:PORT/BUCKET/PREFIX
+//
+// which stores them in an S3-compatible bucket. The credentials default
+// to the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment
+// variables, and HTTPS is used unless ?secure=false is given.
+func OpenStore(uri string) (Store, error) {
+	if !strings.HasPrefix(uri, "s3://") {
+		return NewFilesystemStore(strings.TrimPrefix(uri, "file://")), nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if u.User != nil {
+		accessKey = u.User.Username()
+		secretKey, _ = u.User.Password()
 	}
+
+	parts := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		return nil, errors.New("no bucket given in " + uri)
+	}
+
+	var prefix string
+	if len(parts) > 1 {
+		prefix = parts[1]
+	}
+
+	return NewS3Store(S3Config{
+		Endpoint:  u.Host,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Secure:    u.Query().Get("secure") != "false",
+		Bucket:    parts[0],
+		Prefix:    prefix,
+	})
 }
 
-func (s *Store) ImagePath(key string) string {
-	return path.Join(s.RootPath, string(key[0]), key)
+// ReadImage returns the image's data.
+func ReadImage(s Store, key string) ([]byte, error) {
+	r, err := s.OpenImage(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
 }
 
-func (s *Store) WriteImage(key string, data []byte) error {
-	fpath := s.ImagePath(key)
+// Copy copies every image in src that isn't in dst to dst and returns the
+// number of images copied. Thumbnails aren't copied since they're
+// regenerated as needed.
+func Copy(dst Store, src Store) (int, error) {
+	keys, err := src.Keys()
+	if err != nil {
+		return 0, err
+	}
 
-	err := os.MkdirAll(filepath.Dir(fpath), permissions)
+	dstKeys, err := dst.Keys()
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	existing := make(map[string]bool)
+	for _, key := range dstKeys {
+		existing[key] = true
+	}
+
+	copied := 0
+	for _, key := range keys {
+		if existing[key] {
+			continue
+		}
+
+		data, err := ReadImage(src, key)
+		if err != nil {
+			return copied, err
+		}
+
+		if err := dst.WriteImage(key, data); err != nil {
+			return copied, err
+		}
+		copied++
 	}
 
-	return ioutil.WriteFile(fpath, data, permissions)
+	return copied, nil
 }
 
-func (s *Store) ReadImage(key string) ([]byte, error) {
-	fpath := s.ImagePath(key)
-	return ioutil.ReadFile(fpath)
+func nopCloser(data []byte) io.ReadCloser {
+	return ioutil.NopCloser(bytes.NewReader(data))
 }
@@ -0,0 +1,124 @@
+package artwork
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+)
+
+// ThumbnailSizes are the sizes in pixels of the longest side of the
+// thumbnails the store generates.
+var ThumbnailSizes = []int{64, 256, 512, 1024}
+
+const thumbnailQuality = 85
+
+// ErrNoThumbnail is returned for images no larger than the thumbnail size,
+// which should be served as is.
+var ErrNoThumbnail = errors.New("image is no larger than the thumbnail")
+
+// ThumbnailSize returns the smallest thumbnail size that's at least size,
+// or the largest thumbnail size.
+func ThumbnailSize(size int) int {
+	for _, s := range ThumbnailSizes {
+		if s >= size {
+			return s
+		}
+	}
+
+	return ThumbnailSizes[len(ThumbnailSizes)-1]
+}
+
+// OpenThumbnail opens a JPEG of the image scaled to fit within size
+// pixels, generating it if it isn't in the store already.
+func OpenThumbnail(s Store, key string, size int) (io.ReadCloser, error) {
+	r, err := s.OpenThumbnail(key, size)
+	if err != ErrNotFound {
+		return r, err
+	}
+
+	data, err := ReadImage(s, key)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() <= size && bounds.Dy() <= size {
+		return nil, ErrNoThumbnail
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resize(img, size), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, err
+	}
+
+	// Concurrent requests may both generate the thumbnail, which is
+	// harmless since stores replace thumbnails atomically
+	if err := s.WriteThumbnail(key, size, buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return nopCloser(buf.Bytes()), nil
+}
+
+// resize scales img down to fit within size pixels, averaging the source
+// pixels covered by each destination pixel.
+func resize(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := size, size
+	if srcW > srcH {
+		dstH = maxInt(1, srcH*size/srcW)
+	} else {
+		dstW = maxInt(1, srcW*size/srcH)
+	}
+
+	// JPEGs have no alpha channel, so transparent images are drawn on white
+	src := image.NewRGBA(image.Rect(0, 0, srcW, srcH))
+	draw.Draw(src, src.Bounds(), image.White, image.ZP, draw.Src)
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Over)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0, y1 := y*srcH/dstH, (y+1)*srcH/dstH
+		for x := 0; x < dstW; x++ {
+			x0, x1 := x*srcW/dstW, (x+1)*srcW/dstW
+
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					n++
+					i += 4
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
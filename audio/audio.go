@@ -5,10 +5,10 @@ import (
 	"os"
 	"path"
 	"strings"
-	"time"
 
 	"github.com/cjlucas/tenor/audio/parsers/flac"
 	"github.com/cjlucas/tenor/audio/parsers/mp3"
+	"github.com/cjlucas/tenor/date"
 )
 
 type Metadata interface {
@@ -20,13 +20,25 @@ type Metadata interface {
 	AlbumArtistName() string
 	AlbumName() string
 
-	ReleaseDate() time.Time
-	OriginalReleaseDate() time.Time
+	ReleaseDate() date.Date
+	OriginalReleaseDate() date.Date
 
 	DiscName() string
 	DiscPosition() int
 	TotalDiscs() int
 
+	Composers() []string
+	Conductors() []string
+	Performers() []string
+
+	WorkName() string
+	MovementName() string
+	MovementPosition() int
+
+	// Compilation reports whether the track is part of a compilation
+	// by various artists.
+	Compilation() bool
+
 	Duration() float64
 
 	Images() [][]byte
@@ -5,7 +5,8 @@ import (
 	"io"
 	"strconv"
 	"strings"
-	"time"
+
+	"github.com/cjlucas/tenor/date"
 )
 
 func Parse(r io.Reader) (*Metadata, error) {
@@ -48,11 +49,13 @@ func Parse(r io.Reader) (*Metadata, error) {
 		}
 	}
 
+	// Field names are case insensitive
 	for _, vorbisComment := range metadata.vorbisCommentBlocks {
-		for key, value := range vorbisComment.UserComments {
+		for key, values := range vorbisComment.UserComments {
+			key = strings.ToUpper(key)
 			userCommentsByName := metadata.userComments[key]
 
-			userCommentsByName = append(userCommentsByName, value)
+			userCommentsByName = append(userCommentsByName, values...)
 			metadata.userComments[key] = userCommentsByName
 		}
 	}
@@ -117,30 +120,30 @@ func (m *Metadata) AlbumName() string {
 	return strings.Join(m.userComments["ALBUM"], ", ")
 }
 
-func (m *Metadata) ReleaseDate() time.Time {
+func (m *Metadata) ReleaseDate() date.Date {
 	userComments := m.userComments["DATE"]
 
 	for _, dateStr := range userComments {
-		t := parseTime(dateStr)
-		if !t.IsZero() {
-			return t
+		d := parseTime(dateStr)
+		if !d.IsZero() {
+			return d
 		}
 	}
 
-	return time.Time{}
+	return date.Date{}
 }
 
-func (m *Metadata) OriginalReleaseDate() time.Time {
+func (m *Metadata) OriginalReleaseDate() date.Date {
 	userComments := m.userComments["ORIGINALDATE"]
 
 	for _, dateStr := range userComments {
-		t := parseTime(dateStr)
-		if !t.IsZero() {
-			return t
+		d := parseTime(dateStr)
+		if !d.IsZero() {
+			return d
 		}
 	}
 
-	return time.Time{}
+	return date.Date{}
 }
 
 func (m *Metadata) DiscName() string {
@@ -178,6 +181,51 @@ func (m *Metadata) TotalDiscs() int {
 	return 0
 }
 
+func (m *Metadata) Composers() []string {
+	return m.userComments["COMPOSER"]
+}
+
+func (m *Metadata) Conductors() []string {
+	return m.userComments["CONDUCTOR"]
+}
+
+func (m *Metadata) Performers() []string {
+	return m.userComments["PERFORMER"]
+}
+
+func (m *Metadata) WorkName() string {
+	return strings.Join(m.userComments["WORK"], ", ")
+}
+
+func (m *Metadata) MovementName() string {
+	return strings.Join(m.userComments["MOVEMENTNAME"], ", ")
+}
+
+func (m *Metadata) MovementPosition() int {
+	userComments := m.userComments["MOVEMENT"]
+
+	for _, movementStr := range userComments {
+		n, err := strconv.Atoi(movementStr)
+		if err != nil {
+			continue
+		}
+
+		return n
+	}
+
+	return 0
+}
+
+func (m *Metadata) Compilation() bool {
+	for _, s := range m.userComments["COMPILATION"] {
+		if s == "1" {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (m *Metadata) Duration() float64 {
 	if m.streamInfoBlock.SampleRate == 0 {
 		return 0
@@ -198,7 +246,7 @@ func (m *Metadata) Images() [][]byte {
 
 type VorbisCommentBlock struct {
 	VendorString string
-	UserComments map[string]string
+	UserComments map[string][]string
 }
 
 func readVorbisCommentBlock(blockData []byte) (*VorbisCommentBlock, error) {
@@ -215,7 +263,7 @@ func readVorbisCommentBlock(blockData []byte) (*VorbisCommentBlock, error) {
 
 	block := VorbisCommentBlock{
 		VendorString: string(blockData[0:vendorLength]),
-		UserComments: make(map[string]string),
+		UserComments: make(map[string][]string),
 	}
 
 	blockData = blockData[vendorLength:]
@@ -241,7 +289,7 @@ func readVorbisCommentBlock(blockData []byte) (*VorbisCommentBlock, error) {
 			return nil, errors.New("failed to split comment")
 		}
 
-		block.UserComments[split[0]] = split[1]
+		block.UserComments[split[0]] = append(block.UserComments[split[0]], split[1])
 
 		blockData = blockData[commentLen:]
 	}
@@ -346,22 +394,8 @@ func readPictureBlock(data []byte) (*PictureBlock, error) {
 	return &pictureBlock, nil
 }
 
-var timestampFormats = [...]string{
-	"2006-01-02T15:04:05",
-	"2006-01-02T15:04",
-	"2006-01-02T15",
-	"2006-01-02",
-	"2006-01",
-	"2006",
-}
-
-func parseTime(timeStr string) time.Time {
-	for _, timeFmt := range timestampFormats {
-		t, err := time.Parse(timeFmt, timeStr)
-		if err == nil {
-			return t
-		}
-	}
+func parseTime(timeStr string) date.Date {
+	d, _ := date.Parse(timeStr)
 
-	return time.Time{}
+	return d
 }
@@ -1,9 +1,10 @@
 package mp3
 
 import (
-	"errors"
-	"time"
+	"strings"
 	"unicode/utf16"
+
+	"github.com/cjlucas/tenor/date"
 )
 
 type ID3v2Tag struct {
@@ -83,24 +84,8 @@ func (id3 *ID3v2Tag) Parse(buf []byte) {
 	}
 }
 
-var timestampFormats = []string{
-	"2006-01-02T15:04:05",
-	"2006-01-02T15:04",
-	"2006-01-02T15",
-	"2006-01-02",
-	"2006-01",
-	"2006",
-}
-
-func ParseID3Time(timeStr string) (time.Time, error) {
-	for i := range timestampFormats {
-		t, err := time.Parse(timestampFormats[i], timeStr)
-		if err == nil {
-			return t, nil
-		}
-	}
-
-	return time.Time{}, errors.New("invalid time")
+func ParseID3Time(timeStr string) (date.Date, error) {
+	return date.Parse(timeStr)
 }
 
 func splitTerminator(buf []byte, term []byte) ([]byte, []byte) {
@@ -168,7 +153,7 @@ func parseID3String(encoding int, buf []byte) (string, []byte) {
 	case 0, 3:
 		text = string(textBuf)
 	case 1:
-		if len(buf) > 2 {
+		if len(textBuf) >= 2 {
 			text = parseBOMString(textBuf)
 		}
 	case 2:
@@ -184,19 +169,42 @@ func parseTextFrame(frame *ID3v2Frame) ID3v2TextFrame {
 	enc := frame.Payload[0]
 	buf := frame.Payload[1:]
 
-	text, _ := parseID3String(int(enc), buf)
+	text, rest := parseID3String(int(enc), buf)
+	// The terminator may be left on the end of the last value
+	text = strings.TrimRight(text, "\x00")
+
+	var values []string
+	if text != "" {
+		values = append(values, text)
+	}
+
+	// ID3v2.4 allows multiple values separated by the encoding's terminator
+	for len(rest) > 0 {
+		var value string
+		value, rest = parseID3String(int(enc), rest)
+		if value = strings.TrimRight(value, "\x00"); value != "" {
+			values = append(values, value)
+		}
+	}
 
 	return ID3v2TextFrame{
-		ID:   frame.ID,
-		Text: text,
+		ID:     frame.ID,
+		Text:   text,
+		Values: values,
 	}
 }
 
+// isMovementFrame reports whether the frame is one of the iTunes movement
+// frames, which hold text but don't follow the T*** naming convention.
+func isMovementFrame(frame *ID3v2Frame) bool {
+	return frame.ID == "MVNM" || frame.ID == "MVIN"
+}
+
 func (id3 *ID3v2Tag) TextFrames() []ID3v2TextFrame {
 	var frames []ID3v2TextFrame
 	for i := range id3.Frames {
 		frame := &id3.Frames[i]
-		if frame.ID[0] == 'T' && frame.ID[1] != 'X' && frame.ID[2] != 'X' && frame.ID[3] != 'X' {
+		if (frame.ID[0] == 'T' && frame.ID[1] != 'X' && frame.ID[2] != 'X' && frame.ID[3] != 'X') || isMovementFrame(frame) {
 			frames = append(frames, parseTextFrame(frame))
 		}
 	}
@@ -240,8 +248,9 @@ type ID3v2Frame struct {
 }
 
 type ID3v2TextFrame struct {
-	ID   string
-	Text string
+	ID     string
+	Text   string
+	Values []string
 }
 
 type APICFrame struct {
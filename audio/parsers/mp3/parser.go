@@ -6,6 +6,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/cjlucas/tenor/date"
 )
 
 func Parse(r io.Reader) (*Metadata, error) {
@@ -227,7 +229,7 @@ func (m *Metadata) AlbumName() string {
 	return ""
 }
 
-func (m *Metadata) ReleaseDate() time.Time {
+func (m *Metadata) ReleaseDate() date.Date {
 	var releaseDateFrame *ID3v2TextFrame
 
 	// v2.3
@@ -241,29 +243,30 @@ func (m *Metadata) ReleaseDate() time.Time {
 	}
 
 	if releaseDateFrame == nil {
-		return time.Time{}
+		return date.Date{}
 	}
 
 	releaseDate, err := ParseID3Time(releaseDateFrame.Text)
 
 	if err != nil {
-		return time.Time{}
+		return date.Date{}
 	}
 
-	// TYER+TDAT
-	if frame := m.findID3v2TextFrameByID("TDAT"); frame != nil && len(frame.Text) == 4 {
-		month, _ := strconv.Atoi(frame.Text[:2])
-		day, _ := strconv.Atoi(frame.Text[2:4])
+	// TYER+TDAT (DDMM)
+	if frame := m.findID3v2TextFrameByID("TDAT"); frame != nil && len(frame.Text) == 4 && releaseDate.Precision == date.Year {
+		day, _ := strconv.Atoi(frame.Text[:2])
+		month, _ := strconv.Atoi(frame.Text[2:4])
 
-		if month <= 12 && day <= 31 {
-			releaseDate.AddDate(0, month, day)
+		if month >= 1 && month <= 12 && day >= 1 && day <= 31 {
+			t := time.Date(releaseDate.Time.Year(), time.Month(month), day, 0, 0, 0, 0, time.UTC)
+			releaseDate = date.New(t, date.Day)
 		}
 	}
 
 	return releaseDate
 }
 
-func (m *Metadata) OriginalReleaseDate() time.Time {
+func (m *Metadata) OriginalReleaseDate() date.Date {
 	var releaseDateFrame *ID3v2TextFrame
 
 	// v2.3
@@ -277,13 +280,13 @@ func (m *Metadata) OriginalReleaseDate() time.Time {
 	}
 
 	if releaseDateFrame == nil {
-		return time.Time{}
+		return date.Date{}
 	}
 
 	releaseDate, err := ParseID3Time(releaseDateFrame.Text)
 
 	if err != nil {
-		return time.Time{}
+		return date.Date{}
 	}
 
 	return releaseDate
@@ -317,6 +320,71 @@ func (m *Metadata) TotalDiscs() int {
 	return 0
 }
 
+func (m *Metadata) textFrameValues(frameID string) []string {
+	if frame := m.findID3v2TextFrameByID(frameID); frame != nil {
+		return frame.Values
+	}
+
+	return nil
+}
+
+func (m *Metadata) Composers() []string {
+	return m.textFrameValues("TCOM")
+}
+
+func (m *Metadata) Conductors() []string {
+	return m.textFrameValues("TPE3")
+}
+
+func (m *Metadata) Performers() []string {
+	var performers []string
+
+	// TMCL is a list of alternating instrument and musician values. TIPL
+	// has the same format but lists other people involved, such as
+	// producers and engineers, so it isn't included.
+	values := m.textFrameValues("TMCL")
+	for i := 1; i < len(values); i += 2 {
+		performers = append(performers, values[i])
+	}
+
+	return performers
+}
+
+func (m *Metadata) WorkName() string {
+	if frame := m.findID3v2TextFrameByID("TIT1"); frame != nil {
+		return frame.Text
+	}
+
+	return ""
+}
+
+func (m *Metadata) MovementName() string {
+	if frame := m.findID3v2TextFrameByID("MVNM"); frame != nil {
+		return frame.Text
+	}
+
+	return ""
+}
+
+func (m *Metadata) MovementPosition() int {
+	if frame := m.findID3v2TextFrameByID("MVIN"); frame != nil {
+		pos, _ := parseID3Position(frame.Text)
+
+		return pos
+	}
+
+	return 0
+}
+
+// Compilation uses the iTunes TCMP frame
+func (m *Metadata) Compilation() bool {
+	if frame := m.findID3v2TextFrameByID("TCMP"); frame != nil {
+		return frame.Text == "1"
+	}
+
+	return false
+}
+
 func (m *Metadata) Images() [][]byte {
 	var images [][]byte
 
@@ -0,0 +1,70 @@
+package date
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Precision describes which components of a Date are actually known.
+type Precision int
+
+const (
+	None Precision = iota
+	Year
+	Month
+	Day
+)
+
+// Date is a possibly partial calendar date. Unknown components of Time are
+// set to the start of the known period (e.g. a Year date is January 1st).
+type Date struct {
+	Time      time.Time
+	Precision Precision
+}
+
+var formats = []struct {
+	layout    string
+	precision Precision
+}{
+	{"2006-01-02T15:04:05", Day},
+	{"2006-01-02T15:04", Day},
+	{"2006-01-02T15", Day},
+	{"2006-01-02", Day},
+	{"2006-01", Month},
+	{"2006", Year},
+}
+
+func New(t time.Time, precision Precision) Date {
+	return Date{Time: t, Precision: precision}
+}
+
+func Parse(s string) (Date, error) {
+	for _, f := range formats {
+		t, err := time.Parse(f.layout, s)
+		if err == nil {
+			return Date{Time: t, Precision: f.precision}, nil
+		}
+	}
+
+	return Date{}, errors.New("invalid date")
+}
+
+func (d Date) IsZero() bool {
+	return d.Precision == None
+}
+
+// String formats the date using only its known components,
+// e.g. "1997", "1997-05" or "1997-05-12".
+func (d Date) String() string {
+	switch d.Precision {
+	case Year:
+		return fmt.Sprintf("%04d", d.Time.Year())
+	case Month:
+		return fmt.Sprintf("%04d-%02d", d.Time.Year(), d.Time.Month())
+	case Day:
+		return d.Time.Format("2006-01-02")
+	default:
+		return ""
+	}
+}
@@ -3,7 +3,10 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/cjlucas/tenor/date"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
@@ -22,6 +25,7 @@ type DB struct {
 	eventManager *EventManager
 
 	Files        *FileCollection
+	LibraryRoots *LibraryRootCollection
 	Tracks       *TrackCollection
 	Artists      *ArtistCollection
 	AlbumArtists *ArtistCollection
@@ -29,53 +33,203 @@ type DB struct {
 	AlbumsView   *AlbumCollection
 	Discs        *DiscCollection
 	Images       *ImageCollection
+	TrackCredits *TrackCreditCollection
+	Composers    *ArtistCollection
+	Works        *WorkCollection
+
+	Overrides      *OverrideCollection
+	AlbumOverrides *AlbumOverrideCollection
+	Plays          *PlayCollection
+	Ratings        *RatingCollection
+	RemovedTracks  *RemovedTrackCollection
+
+	Attributes *AttributeCollection
+
+	ArtistAliases *ArtistAliasCollection
+	AlbumAliases  *AlbumAliasCollection
 }
 
+// busyTimeout is how long in milliseconds a write waits for another
+// connection's transaction to finish
+const busyTimeout = 30000
+
 func Open(fpath string) (*DB, error) {
-	gdb, err := gorm.Open("sqlite3", fpath)
+	// Writers wait for each other rather than failing with "database is
+	// locked"
+	gdb, err := gorm.Open("sqlite3", fpath+"?_busy_timeout="+strconv.Itoa(busyTimeout))
 	if err != nil {
 		return nil, err
 	}
 
 	gdb.LogMode(true)
 
-	gdb.AutoMigrate(&File{}, &Artist{}, &Track{}, &Disc{}, &Album{}, &Image{})
+	gdb.AutoMigrate(&File{}, &Artist{}, &Track{}, &Disc{}, &Album{}, &Image{}, &TrackCredit{}, &Work{}, &LibraryRoot{}, &ArtistAlias{}, &AlbumAlias{}, &Override{}, &AlbumOverride{}, &Play{}, &Rating{}, &RemovedTrack{}, &Attribute{})
 
-	db := &DB{db: gdb}
+	db := &DB{db: gdb, eventManager: &EventManager{}}
+	for _, v := range views {
+		db.Exec("DROP VIEW IF EXISTS " + v.Name)
+		db.Exec("CREATE VIEW " + v.Name + " AS " + v.SQL)
+	}
 	db.init()
 
+	if err := db.normalizeArtistNames(); err != nil {
+		return nil, err
+	}
+
+	if err := db.backfillDatePrecisions(); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
-func (db *DB) init() {
-	db.eventManager = &EventManager{}
+// normalizeArtistNames sets the normalized names of artists created before
+// names were normalized, or whose normalized name has changed since, and
+// merges the artists that turn out to have the same name into the oldest.
+func (db *DB) normalizeArtistNames() error {
+	var artists []Artist
+	if err := db.Raw("SELECT * FROM artists ORDER BY created_at, id").Scan(&artists); err != nil {
+		return err
+	}
+
+	targets := make(map[string]string)
+	for _, artist := range artists {
+		normalized := NormalizeName(artist.Name)
+		if normalized != artist.NormalizedName {
+			err := db.Exec("UPDATE artists SET normalized_name = ? WHERE id = ?", normalized, artist.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		targetID, ok := targets[normalized]
+		if !ok {
+			targets[normalized] = artist.ID
+			continue
+		}
+
+		if err := db.MergeArtists(artist.ID, targetID); err != nil {
+			return err
+		}
+
+		if err := db.mergeDuplicateAlbums(targetID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeDuplicateAlbums merges the albums of the artist that the scanner
+// would consider the same album into the oldest of them.
+func (db *DB) mergeDuplicateAlbums(artistID string) error {
+	var albums []Album
+	err := db.Raw("SELECT * FROM albums WHERE artist_id = ? ORDER BY created_at, id", artistID).Scan(&albums)
+	if err != nil {
+		return err
+	}
+
+	type albumKey struct {
+		Name      string
+		Directory string
+	}
+
+	targets := make(map[albumKey]string)
+	for _, album := range albums {
+		// Only compilations are told apart by their directory
+		key := albumKey{Name: album.Name}
+		if album.IsCompilation {
+			key.Directory = album.Directory
+		}
+
+		targetID, ok := targets[key]
+		if !ok {
+			targets[key] = album.ID
+			continue
+		}
+
+		if err := db.MergeAlbums(album.ID, targetID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backfillDatePrecisions sets the precision of dates saved before
+// precisions were recorded. Their precision is unknown, so they're treated
+// as years, the least precise a non-zero date can be.
+func (db *DB) backfillDatePrecisions() error {
+	for _, table := range []string{"tracks", "albums"} {
+		for _, column := range []string{"release_date", "original_release_date"} {
+			err := db.Exec("UPDATE "+table+" SET "+column+"_precision = ? WHERE ("+
+				column+"_precision IS NULL OR "+column+"_precision = ?) AND "+column+" > ?",
+				date.Year, date.None, time.Time{})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+var views = []struct {
+	Name string
+	SQL  string
+}{
+	{
+		"album_artists",
+		`SELECT DISTINCT artists.*
+		FROM artists
+		JOIN albums ON artists.id = albums.artist_id`,
+	},
+	{
+		"albums_artists_fields",
+		`SELECT albums.*, artists.name AS artist_name
+		FROM albums
+		JOIN artists ON artists.id = albums.artist_id`,
+	},
+	{
+		"composers",
+		`SELECT DISTINCT artists.*
+		FROM artists
+		JOIN track_credits ON artists.id = track_credits.artist_id
+		WHERE track_credits.role = '` + ComposerRole + `'`,
+	},
+}
 
+func (db *DB) init() {
 	db.Files = &FileCollection{Collection{db.model(&File{})}}
+	db.LibraryRoots = &LibraryRootCollection{Collection{db.model(&LibraryRoot{})}}
 	db.Tracks = &TrackCollection{Collection{db.model(&Track{})}}
 	db.Artists = &ArtistCollection{Collection{db.model(&Artist{})}}
-	db.AlbumArtists = &ArtistCollection{
-		db.createView("album_artists",
-			`SELECT DISTINCT artists.*
-			FROM artists
-			JOIN albums ON artists.id = albums.artist_id`),
-	}
+	db.AlbumArtists = &ArtistCollection{db.view("album_artists")}
 
 	db.Albums = &AlbumCollection{Collection{db.model(&Album{})}}
-	db.AlbumsView = &AlbumCollection{
-		db.createView("albums_artists_fields",
-			`SELECT albums.*, artists.name AS artist_name
-			FROM albums
-			JOIN artists ON artists.id = albums.artist_id`),
-	}
+	db.AlbumsView = &AlbumCollection{db.view("albums_artists_fields")}
 
 	db.Discs = &DiscCollection{Collection{db.model(&Disc{})}}
 	db.Images = &ImageCollection{Collection{db.model(&Image{})}}
-}
 
-func (db *DB) createView(name string, sql string) Collection {
-	db.Exec("DROP VIEW IF EXISTS " + name)
-	db.Exec("CREATE VIEW " + name + " AS " + sql)
+	db.TrackCredits = &TrackCreditCollection{Collection{db.model(&TrackCredit{})}}
+	db.Composers = &ArtistCollection{db.view("composers")}
 
+	db.Works = &WorkCollection{Collection{db.model(&Work{})}}
+
+	db.Overrides = &OverrideCollection{Collection{db.model(&Override{})}}
+	db.AlbumOverrides = &AlbumOverrideCollection{Collection{db.model(&AlbumOverride{})}}
+	db.Plays = &PlayCollection{Collection{db.model(&Play{})}}
+	db.Ratings = &RatingCollection{Collection{db.model(&Rating{})}}
+	db.RemovedTracks = &RemovedTrackCollection{Collection{db.model(&RemovedTrack{})}}
+
+	db.Attributes = &AttributeCollection{Collection{db.model(&Attribute{})}}
+
+	db.ArtistAliases = &ArtistAliasCollection{Collection{db.model(&ArtistAlias{})}}
+	db.AlbumAliases = &AlbumAliasCollection{Collection{db.model(&AlbumAlias{})}}
+}
+
+func (db *DB) view(name string) Collection {
 	return Collection{
 		&DB{
 			db: db.db.Table(name),
@@ -99,10 +253,57 @@ func (db *DB) wrapErrors(gdb *gorm.DB) error {
 	return &Error{Errors: errors}
 }
 
+// Transaction calls fn with a DB whose collections all run within a single
+// transaction. The transaction is committed if fn returns nil and rolled
+// back otherwise. Change events are held until the transaction commits and
+// are discarded on rollback. Calling Transaction on a DB that is already in
+// a transaction calls fn within that transaction.
+func (db *DB) Transaction(fn func(tx *DB) error) error {
+	if db.eventManager.deferring {
+		return fn(db)
+	}
+
+	gtx := db.db.Begin()
+	if err := db.wrapErrors(gtx); err != nil {
+		return err
+	}
+
+	tx := &DB{db: gtx, eventManager: db.eventManager.deferred()}
+	tx.init()
+
+	defer func() {
+		if r := recover(); r != nil {
+			gtx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		gtx.Rollback()
+		return err
+	}
+
+	if err := db.wrapErrors(gtx.Commit()); err != nil {
+		return err
+	}
+
+	tx.eventManager.flush()
+
+	return nil
+}
+
 func (db *DB) Register(handler interface{}) {
 	db.eventManager.Register(handler)
 }
 
+func (db *DB) Deregister(handler interface{}) {
+	db.eventManager.Deregister(handler)
+}
+
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
 func (db *DB) Raw(sql string, vals ...interface{}) *DB {
 	return &DB{db: db.db.Raw(sql, vals...)}
 }
@@ -152,6 +353,15 @@ func (c *Collection) Update(val interface{}) error {
 	return err
 }
 
+func (c *Collection) Delete(val interface{}) error {
+	err := c.db.wrapErrors(c.db.db.Delete(val))
+	if err == nil {
+		c.dispatchEvent(val, Deleted)
+	}
+
+	return err
+}
+
 // TODO: this should be private. All FirstOrCreate implementations should
 // be provided by the model-specific types.
 func (c *Collection) FirstOrCreate(query interface{}, val interface{}) error {
@@ -170,6 +380,10 @@ func (c *Collection) All(out interface{}) error {
 	return c.db.wrapErrors(c.db.db.Find(out))
 }
 
+func (c *Collection) Pluck(column string, out interface{}) error {
+	return c.db.wrapErrors(c.db.db.Pluck(column, out))
+}
+
 func (c *Collection) Rows() (*sql.Rows, error) {
 	return c.db.db.Rows()
 }
@@ -237,6 +451,18 @@ func (c *FileCollection) FirstOrCreate(file *File) error {
 	return c.Collection.FirstOrCreate(query, file)
 }
 
+type LibraryRootCollection struct {
+	Collection
+}
+
+func (c *LibraryRootCollection) FirstOrCreate(root *LibraryRoot) error {
+	query := map[string]interface{}{
+		"path": root.Path,
+	}
+
+	return c.Collection.FirstOrCreate(query, root)
+}
+
 type TrackCollection struct {
 	Collection
 }
@@ -245,8 +471,20 @@ type ArtistCollection struct {
 	Collection
 }
 
+// FirstOrCreate finds the artist by its normalized name, following any
+// alias for it.
 func (c *ArtistCollection) FirstOrCreate(artist *Artist) error {
-	query := map[string]interface{}{"name": artist.Name}
+	normalized := NormalizeName(artist.Name)
+
+	var alias ArtistAlias
+	c.db.Raw("SELECT * FROM artist_aliases WHERE normalized_name = ?", normalized).Scan(&alias)
+	if alias.TargetName != "" {
+		artist.Name = alias.TargetName
+		normalized = NormalizeName(alias.TargetName)
+	}
+
+	artist.NormalizedName = normalized
+	query := map[string]interface{}{"normalized_name": normalized}
 
 	return c.Collection.FirstOrCreate(query, artist)
 }
@@ -256,11 +494,25 @@ type AlbumCollection struct {
 }
 
 func (c *AlbumCollection) FirstOrCreate(album *Album) error {
+	var alias AlbumAlias
+	c.db.Raw("SELECT * FROM album_aliases WHERE name = ? AND artist_id = ? AND directory = ?",
+		album.Name, album.ArtistID, album.Directory).Scan(&alias)
+	if alias.AlbumID != "" {
+		if err := c.ByID(alias.AlbumID, album); err == nil {
+			return nil
+		}
+	}
+
 	query := map[string]interface{}{
 		"name":      album.Name,
 		"artist_id": album.ArtistID,
 	}
 
+	if album.IsCompilation {
+		query["is_compilation"] = true
+		query["directory"] = album.Directory
+	}
+
 	return c.Collection.FirstOrCreate(query, album)
 }
 
@@ -288,3 +540,105 @@ func (c *ImageCollection) FirstOrCreate(image *Image) error {
 
 	return c.Collection.FirstOrCreate(query, image)
 }
+
+type TrackCreditCollection struct {
+	Collection
+}
+
+type WorkCollection struct {
+	Collection
+}
+
+func (c *WorkCollection) FirstOrCreate(work *Work) error {
+	query := map[string]interface{}{
+		"name":      work.Name,
+		"artist_id": work.ArtistID,
+	}
+
+	return c.Collection.FirstOrCreate(query, work)
+}
+
+type OverrideCollection struct {
+	Collection
+}
+
+func (c *OverrideCollection) FirstOrCreate(override *Override) error {
+	query := map[string]interface{}{
+		"track_id": override.TrackID,
+		"field":    override.Field,
+	}
+
+	return c.Collection.FirstOrCreate(query, override)
+}
+
+type AlbumOverrideCollection struct {
+	Collection
+}
+
+func (c *AlbumOverrideCollection) FirstOrCreate(override *AlbumOverride) error {
+	query := map[string]interface{}{
+		"album_id": override.AlbumID,
+		"field":    override.Field,
+	}
+
+	return c.Collection.FirstOrCreate(query, override)
+}
+
+type PlayCollection struct {
+	Collection
+}
+
+type RatingCollection struct {
+	Collection
+}
+
+func (c *RatingCollection) FirstOrCreate(rating *Rating) error {
+	query := map[string]interface{}{
+		"track_id": rating.TrackID,
+	}
+
+	return c.Collection.FirstOrCreate(query, rating)
+}
+
+type RemovedTrackCollection struct {
+	Collection
+}
+
+type AttributeCollection struct {
+	Collection
+}
+
+func (c *AttributeCollection) FirstOrCreate(attr *Attribute) error {
+	query := map[string]interface{}{
+		"owner_id": attr.OwnerID,
+		"key":      attr.Key,
+	}
+
+	return c.Collection.FirstOrCreate(query, attr)
+}
+
+type ArtistAliasCollection struct {
+	Collection
+}
+
+func (c *ArtistAliasCollection) FirstOrCreate(alias *ArtistAlias) error {
+	query := map[string]interface{}{
+		"normalized_name": alias.NormalizedName,
+	}
+
+	return c.Collection.FirstOrCreate(query, alias)
+}
+
+type AlbumAliasCollection struct {
+	Collection
+}
+
+func (c *AlbumAliasCollection) FirstOrCreate(alias *AlbumAlias) error {
+	query := map[string]interface{}{
+		"name":      alias.Name,
+		"artist_id": alias.ArtistID,
+		"directory": alias.Directory,
+	}
+
+	return c.Collection.FirstOrCreate(query, alias)
+}
@@ -22,6 +22,36 @@ type trackChangedHandler interface {
 
 type EventManager struct {
 	handlers []interface{}
+
+	// When deferring, events are queued until flush is called
+	deferring bool
+	queue     []func()
+}
+
+// deferred returns an EventManager with the same handlers whose events
+// are held until flush is called.
+func (m *EventManager) deferred() *EventManager {
+	return &EventManager{
+		handlers:  m.handlers,
+		deferring: true,
+	}
+}
+
+func (m *EventManager) flush() {
+	queue := m.queue
+	m.queue = nil
+
+	for _, fn := range queue {
+		fn()
+	}
+}
+
+func (m *EventManager) dispatch(fn func()) {
+	if m.deferring {
+		m.queue = append(m.queue, fn)
+	} else {
+		fn()
+	}
 }
 
 func (m *EventManager) Register(handler interface{}) {
@@ -38,25 +68,31 @@ func (m *EventManager) Deregister(handler interface{}) {
 }
 
 func (m *EventManager) dispatchArtistChange(artist *Artist, eventType EventType) {
-	for _, handler := range m.handlers {
-		if h, ok := handler.(artistChangedHandler); ok {
-			h.ArtistChanged(artist, eventType)
+	m.dispatch(func() {
+		for _, handler := range m.handlers {
+			if h, ok := handler.(artistChangedHandler); ok {
+				h.ArtistChanged(artist, eventType)
+			}
 		}
-	}
+	})
 }
 
 func (m *EventManager) dispatchAlbumChange(album *Album, eventType EventType) {
-	for _, handler := range m.handlers {
-		if h, ok := handler.(albumChangedHandler); ok {
-			h.AlbumChanged(album, eventType)
+	m.dispatch(func() {
+		for _, handler := range m.handlers {
+			if h, ok := handler.(albumChangedHandler); ok {
+				h.AlbumChanged(album, eventType)
+			}
 		}
-	}
+	})
 }
 
 func (m *EventManager) dispatchTrackChange(track *Track, eventType EventType) {
-	for _, handler := range m.handlers {
-		if h, ok := handler.(trackChangedHandler); ok {
-			h.TrackChanged(track, eventType)
+	m.dispatch(func() {
+		for _, handler := range m.handlers {
+			if h, ok := handler.(trackChangedHandler); ok {
+				h.TrackChanged(track, eventType)
+			}
 		}
-	}
+	})
 }
@@ -0,0 +1,136 @@
+package db
+
+import "errors"
+
+// MergeArtists moves the tracks, albums, credits and works of the source
+// artist to the target artist and deletes the source. An alias is added
+// so files tagged with the source's name keep using the target when
+// they're rescanned.
+func (db *DB) MergeArtists(sourceID, targetID string) error {
+	if sourceID == targetID {
+		return errors.New("cannot merge an artist into itself")
+	}
+
+	return db.Transaction(func(tx *DB) error {
+		var source, target Artist
+		if err := tx.Artists.ByID(sourceID, &source); err != nil {
+			return err
+		}
+		if err := tx.Artists.ByID(targetID, &target); err != nil {
+			return err
+		}
+
+		for _, table := range []string{"tracks", "albums", "track_credits", "works", "album_aliases"} {
+			err := tx.Exec("UPDATE "+table+" SET artist_id = ? WHERE artist_id = ?", target.ID, source.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Names previously merged into the source now refer to the target
+		err := tx.Exec("UPDATE artist_aliases SET target_name = ? WHERE target_name = ?", target.Name, source.Name)
+		if err != nil {
+			return err
+		}
+
+		if normalized := NormalizeName(source.Name); normalized != NormalizeName(target.Name) {
+			alias := ArtistAlias{NormalizedName: normalized}
+			if err := tx.ArtistAliases.FirstOrCreate(&alias); err != nil {
+				return err
+			}
+
+			alias.TargetName = target.Name
+			if err := tx.ArtistAliases.Update(&alias); err != nil {
+				return err
+			}
+		}
+
+		return tx.Artists.Delete(&source)
+	})
+}
+
+// MergeAlbums moves the tracks and discs of the source album to the target
+// album and deletes the source. Discs at the same position are combined.
+// An alias is added so the source's tracks keep using the target when
+// they're rescanned.
+func (db *DB) MergeAlbums(sourceID, targetID string) error {
+	if sourceID == targetID {
+		return errors.New("cannot merge an album into itself")
+	}
+
+	return db.Transaction(func(tx *DB) error {
+		var source, target Album
+		if err := tx.Albums.ByID(sourceID, &source); err != nil {
+			return err
+		}
+		if err := tx.Albums.ByID(targetID, &target); err != nil {
+			return err
+		}
+
+		var discs []Disc
+		if err := tx.Discs.Where("album_id = ?", source.ID).All(&discs); err != nil {
+			return err
+		}
+
+		for i := range discs {
+			disc := &discs[i]
+
+			var existing []Disc
+			err := tx.Discs.Where("album_id = ? AND position = ?", target.ID, disc.Position).All(&existing)
+			if err != nil {
+				return err
+			}
+
+			if len(existing) == 0 {
+				err = tx.Exec("UPDATE discs SET album_id = ? WHERE id = ?", target.ID, disc.ID)
+			} else {
+				err = tx.Exec("UPDATE tracks SET disc_id = ? WHERE disc_id = ?", existing[0].ID, disc.ID)
+				if err == nil {
+					err = tx.Discs.Delete(disc)
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec("UPDATE tracks SET album_id = ? WHERE album_id = ?", target.ID, source.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Exec("UPDATE album_aliases SET album_id = ? WHERE album_id = ?", target.ID, source.ID); err != nil {
+			return err
+		}
+
+		// The target's own overrides take precedence
+		err := tx.Exec(`UPDATE album_overrides SET album_id = ? WHERE album_id = ?
+			AND field NOT IN (SELECT field FROM album_overrides WHERE album_id = ?)`,
+			target.ID, source.ID, target.ID)
+		if err != nil {
+			return err
+		}
+
+		alias := AlbumAlias{
+			Name:      source.Name,
+			ArtistID:  source.ArtistID,
+			Directory: source.Directory,
+		}
+		if err := tx.AlbumAliases.FirstOrCreate(&alias); err != nil {
+			return err
+		}
+
+		alias.AlbumID = target.ID
+		if err := tx.AlbumAliases.Update(&alias); err != nil {
+			return err
+		}
+
+		if target.ImageID == "" && source.ImageID != "" {
+			target.ImageID = source.ImageID
+			if err := tx.Albums.Update(&target); err != nil {
+				return err
+			}
+		}
+
+		return tx.Albums.Delete(&source)
+	})
+}
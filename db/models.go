@@ -1,8 +1,12 @@
 package db
 
 import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/cjlucas/tenor/date"
 	"github.com/jinzhu/gorm"
 	uuid "github.com/satori/go.uuid"
 )
@@ -34,18 +38,71 @@ func (m *Model) BeforeUpdate(scope *gorm.Scope) error {
 	return nil
 }
 
+// StringList is a list of strings stored as a single comma separated column.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+func (l *StringList) Scan(src interface{}) error {
+	var s string
+	switch src := src.(type) {
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+
+	*l = nil
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+
+	return nil
+}
+
 type File struct {
 	Model
 
-	Path  string
-	Inode uint64 `gorm:"index"`
-	MTime time.Time
+	Path string
+	// CanonicalPath is Path with every symlink resolved. A file reachable
+	// through several paths is stored once, under its canonical path if
+	// that's one of them.
+	CanonicalPath string
+	Inode         uint64 `gorm:"index"`
+	Size          int64
+	MTime         time.Time
+
+	LibraryRootID string `gorm:"index"`
+}
+
+// LibraryRoot is a directory containing part of the library.
+type LibraryRoot struct {
+	Model
+
+	Name     string
+	Path     string     `gorm:"unique_index"`
+	Include  StringList `gorm:"type:text"`
+	Exclude  StringList `gorm:"type:text"`
+	Disabled bool
 }
 
 type Image struct {
 	Model
 
 	MIMEType string
+	// Width and Height are the original image's dimensions in pixels
+	Width  int
+	Height int
+
+	// Colors picked from the image, as hex strings
+	DominantColor string
+	VibrantColor  string
+	MutedColor    string
 
 	Checksum string `gorm:"index"`
 }
@@ -53,12 +110,15 @@ type Image struct {
 type Track struct {
 	Model
 
-	Name                string
-	Position            int
-	TotalTracks         int
-	Duration            float64
-	ReleaseDate         time.Time
-	OriginalReleaseDate time.Time
+	Name        string
+	Position    int
+	TotalTracks int
+	Duration    float64
+
+	ReleaseDate                  time.Time
+	ReleaseDatePrecision         date.Precision
+	OriginalReleaseDate          time.Time
+	OriginalReleaseDatePrecision date.Precision
 
 	File   *File
 	FileID string
@@ -73,28 +133,147 @@ type Track struct {
 	DiscID string `gorm:"index"`
 
 	Image   *Image
-	ImageID string
+	ImageID string `gorm:"index"`
+
+	WorkID           string `gorm:"index"`
+	MovementName     string
+	MovementPosition int
+
+	MusicBrainzID             string
+	MusicBrainzReleaseTrackID string
+	Genres                    StringList `gorm:"type:text"`
+
+	// Fields that were inferred from the file's path rather than its tags
+	InferredFields StringList `gorm:"type:text"`
+	// Fields whose tag values were replaced by an Override
+	OverriddenFields StringList `gorm:"type:text"`
+
+	Credits []TrackCredit
+}
+
+// Override is a user's edit to a track's metadata. It replaces the value
+// of Field from the file's tags every time the track is scanned.
+type Override struct {
+	Model
+
+	TrackID string `gorm:"index"`
+	Field   string
+	Value   string
+}
+
+// AlbumOverride is a user's edit to an album's metadata. It's applied to
+// every track of the album when it's scanned, unless the track has its own
+// Override of Field.
+type AlbumOverride struct {
+	Model
+
+	AlbumID string `gorm:"index"`
+	Field   string
+	Value   string
+}
+
+// RemovedTrack remembers a track that was removed along with its file, so
+// its overrides, plays and rating can be moved to the new track if the file
+// reappears, such as after being moved out of the library and back.
+type RemovedTrack struct {
+	Model
+
+	TrackID string `gorm:"index"`
+	AlbumID string
+
+	// The file's identity, which must all match for the track to be
+	// restored
+	Inode    uint64 `gorm:"index"`
+	Size     int64
+	Duration float64
+}
+
+// Play records that a track was played. Plays imported from other
+// players may only have a total Count and the time of the last play.
+type Play struct {
+	Model
+
+	TrackID  string `gorm:"index"`
+	PlayedAt time.Time
+	Count    int
+	// Source is the player the play was imported from, if any
+	Source string
+}
+
+// Attribute is a custom field of a track or album imported from another
+// library, such as a beets flexible attribute.
+type Attribute struct {
+	Model
+
+	OwnerID string `gorm:"index"`
+	Key     string
+	Value   string
+}
+
+// Rating is a track's rating from 0 to 100.
+type Rating struct {
+	Model
+
+	TrackID string `gorm:"unique_index"`
+	Value   int
 }
 
 type Artist struct {
 	Model
 
 	Name string `gorm:"name"`
+	// NormalizedName identifies the artist, see NormalizeName
+	NormalizedName string `gorm:"index"`
+
+	MusicBrainzID string
 
 	Albums []Album
 	Tracks []Track
 }
 
+// ArtistAlias makes every name that normalizes to NormalizedName refer to
+// the artist named TargetName. Aliases are keyed by name rather than ID so
+// they still apply if the artist is removed and later rescanned.
+type ArtistAlias struct {
+	Model
+
+	NormalizedName string `gorm:"unique_index"`
+	TargetName     string
+}
+
+// AlbumAlias makes the album identified by Name, ArtistID and Directory
+// refer to another album.
+type AlbumAlias struct {
+	Model
+
+	Name      string `gorm:"index"`
+	ArtistID  string
+	Directory string
+	AlbumID   string `gorm:"index"`
+}
+
 type Album struct {
 	Model
 
-	Name                string
-	ReleaseDate         time.Time
-	OriginalReleaseDate time.Time
-	TotalDiscs          int
+	Name       string
+	TotalDiscs int
+
+	ReleaseDate                  time.Time
+	ReleaseDatePrecision         date.Precision
+	OriginalReleaseDate          time.Time
+	OriginalReleaseDatePrecision date.Precision
 
 	ArtistID string `gorm:"index"`
 
+	// Compilations are grouped by the directory containing their tracks
+	// since their artist doesn't tell them apart.
+	IsCompilation bool
+	Directory     string
+
+	MusicBrainzID             string
+	MusicBrainzReleaseGroupID string
+	Genres                    StringList `gorm:"type:text"`
+
 	Discs  []Disc
 	Tracks []Track
 
@@ -116,3 +295,32 @@ type Disc struct {
 
 	Tracks []Track
 }
+
+const (
+	ComposerRole  = "composer"
+	ConductorRole = "conductor"
+	PerformerRole = "performer"
+)
+
+// TrackCredit associates an artist with a track in a role other than
+// the track artist (e.g. composer or conductor).
+type TrackCredit struct {
+	Model
+
+	Role string `gorm:"index"`
+
+	TrackID string `gorm:"index"`
+
+	ArtistID string `gorm:"index"`
+}
+
+type Work struct {
+	Model
+
+	Name string
+
+	// ArtistID refers to the work's composer
+	ArtistID string `gorm:"index"`
+
+	Tracks []Track
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeName returns the form of an artist's name used to identify it,
+// so "Beyonce", "Beyoncé" and "BEYONCÉ" are the same artist. Compatibility
+// characters, case, diacritics, punctuation and repeated whitespace are
+// all ignored. Diacritics are only ignored in Latin, Greek and Cyrillic
+// names, as combining marks distinguish letters in many other scripts,
+// such as the dakuten of ガ and カ.
+func NormalizeName(name string) string {
+	// Casers aren't safe for concurrent use
+	folded := cases.Fold().String(norm.NFKC.String(name))
+
+	var b bytes.Buffer
+	var base rune
+	for _, r := range norm.NFD.String(folded) {
+		if unicode.Is(unicode.Mn, r) {
+			if !isDiacriticScript(base) {
+				b.WriteRune(r)
+			}
+			continue
+		}
+		base = r
+
+		if unicode.IsPunct(r) || unicode.IsSpace(r) {
+			b.WriteRune(' ')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	normalized := strings.Join(strings.Fields(b.String()), " ")
+
+	// Names made up entirely of punctuation are left as is
+	if normalized == "" {
+		return strings.TrimSpace(folded)
+	}
+
+	return norm.NFC.String(normalized)
+}
+
+// isDiacriticScript reports whether combining marks on r are diacritics
+// that can be ignored.
+func isDiacriticScript(r rune) bool {
+	return unicode.In(r, unicode.Latin, unicode.Greek, unicode.Cyrillic)
+}
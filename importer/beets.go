@@ -0,0 +1,374 @@
+package importer
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cjlucas/tenor/db"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+type beetsItem struct {
+	ID      int64
+	Path    string
+	AlbumID int64
+
+	Genre            string
+	MBTrackID        string
+	MBReleaseTrackID string
+	MBArtistID       string
+	Added            float64
+
+	Attributes map[string]string
+}
+
+type beetsAlbum struct {
+	ID int64
+
+	Genre            string
+	MBAlbumID        string
+	MBReleaseGroupID string
+	MBAlbumArtistID  string
+	Added            float64
+
+	Attributes map[string]string
+}
+
+// BeetsImporter imports MusicBrainz IDs, genres, dates added and flexible
+// attributes from a beets library.db. Items are matched to tracks by path,
+// and albums are matched through their items.
+type BeetsImporter struct {
+	DB       *db.DB
+	Rewrites []PathRewrite
+	// DryRun matches items without importing anything
+	DryRun bool
+}
+
+func (i *BeetsImporter) Import(libraryPath string) (*Report, error) {
+	beets, err := sql.Open("sqlite3", "file:"+libraryPath+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer beets.Close()
+
+	items, err := beetsItems(beets)
+	if err != nil {
+		return nil, err
+	}
+
+	albums, err := beetsAlbums(beets)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	err = i.DB.Transaction(func(tx *db.DB) error {
+		// beets album IDs to tenor album IDs
+		albumIDs := make(map[int64]string)
+
+		for _, item := range items {
+			fpath := rewritePath(item.Path, i.Rewrites)
+
+			report.Total++
+
+			id, err := trackByPath(tx, fpath)
+			if err != nil {
+				return err
+			}
+
+			if id == "" {
+				report.Unmatched = append(report.Unmatched, fpath)
+				continue
+			}
+			report.MatchedByPath++
+
+			if i.DryRun {
+				continue
+			}
+
+			albumID, err := i.importItem(tx, id, item)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := albumIDs[item.AlbumID]; !ok && item.AlbumID != 0 {
+				albumIDs[item.AlbumID] = albumID
+			}
+		}
+
+		for _, album := range albums {
+			id, ok := albumIDs[album.ID]
+			if !ok {
+				continue
+			}
+
+			if err := i.importAlbum(tx, id, album); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// importItem updates the track with the item's fields and returns the ID
+// of the track's album.
+func (i *BeetsImporter) importItem(tx *db.DB, trackID string, item *beetsItem) (string, error) {
+	var track db.Track
+	if err := tx.Tracks.ByID(trackID, &track); err != nil {
+		return "", err
+	}
+
+	// Fields beets doesn't know are left as they are
+	if item.MBTrackID != "" {
+		track.MusicBrainzID = item.MBTrackID
+	}
+	if item.MBReleaseTrackID != "" {
+		track.MusicBrainzReleaseTrackID = item.MBReleaseTrackID
+	}
+	if genres := splitGenres(item.Genre); len(genres) > 0 {
+		track.Genres = genres
+	}
+	if err := tx.Tracks.Update(&track); err != nil {
+		return "", err
+	}
+
+	if err := setArtistMusicBrainzID(tx, track.ArtistID, item.MBArtistID); err != nil {
+		return "", err
+	}
+
+	if err := setCreatedAt(tx, "tracks", trackID, item.Added); err != nil {
+		return "", err
+	}
+
+	if err := setAttributes(tx, trackID, item.Attributes); err != nil {
+		return "", err
+	}
+
+	return track.AlbumID, nil
+}
+
+func (i *BeetsImporter) importAlbum(tx *db.DB, albumID string, album *beetsAlbum) error {
+	var dbAlbum db.Album
+	if err := tx.Albums.ByID(albumID, &dbAlbum); err != nil {
+		return err
+	}
+
+	if album.MBAlbumID != "" {
+		dbAlbum.MusicBrainzID = album.MBAlbumID
+	}
+	if album.MBReleaseGroupID != "" {
+		dbAlbum.MusicBrainzReleaseGroupID = album.MBReleaseGroupID
+	}
+	if genres := splitGenres(album.Genre); len(genres) > 0 {
+		dbAlbum.Genres = genres
+	}
+	if err := tx.Albums.Update(&dbAlbum); err != nil {
+		return err
+	}
+
+	// Compilations are credited to tenor's Various Artists artist, which
+	// isn't the artist beets knows about
+	if !dbAlbum.IsCompilation {
+		if err := setArtistMusicBrainzID(tx, dbAlbum.ArtistID, album.MBAlbumArtistID); err != nil {
+			return err
+		}
+	}
+
+	if err := setCreatedAt(tx, "albums", albumID, album.Added); err != nil {
+		return err
+	}
+
+	return setAttributes(tx, albumID, album.Attributes)
+}
+
+func setArtistMusicBrainzID(tx *db.DB, artistID string, mbid string) error {
+	if mbid == "" || artistID == "" {
+		return nil
+	}
+
+	var artist db.Artist
+	if err := tx.Artists.ByID(artistID, &artist); err != nil {
+		return err
+	}
+
+	if artist.MusicBrainzID == mbid {
+		return nil
+	}
+
+	artist.MusicBrainzID = mbid
+	return tx.Artists.Update(&artist)
+}
+
+// setCreatedAt moves created_at back to added, which is a unix timestamp.
+func setCreatedAt(tx *db.DB, table string, id string, added float64) error {
+	if added <= 0 {
+		return nil
+	}
+
+	sec := int64(added)
+	t := time.Unix(sec, int64((added-float64(sec))*1e9)).UTC()
+
+	return tx.Exec("UPDATE "+table+" SET created_at = ? WHERE id = ? AND created_at > ?", t, id, t)
+}
+
+func setAttributes(tx *db.DB, ownerID string, attrs map[string]string) error {
+	for key, value := range attrs {
+		attr := db.Attribute{OwnerID: ownerID, Key: key}
+		if err := tx.Attributes.FirstOrCreate(&attr); err != nil {
+			return err
+		}
+
+		attr.Value = value
+		if err := tx.Attributes.Update(&attr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitGenres splits a beets genre field, which lists multiple genres
+// separated by commas or semicolons.
+func splitGenres(genre string) db.StringList {
+	var genres db.StringList
+	for _, g := range strings.FieldsFunc(genre, func(r rune) bool { return r == ',' || r == ';' }) {
+		if g = strings.TrimSpace(g); g != "" {
+			genres = append(genres, g)
+		}
+	}
+
+	return genres
+}
+
+func beetsItems(beets *sql.DB) ([]*beetsItem, error) {
+	rows, err := beets.Query(`SELECT id, path, album_id, genre, mb_trackid,
+		mb_releasetrackid, mb_artistid, added FROM items`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*beetsItem
+	byID := make(map[int64]*beetsItem)
+	for rows.Next() {
+		var path []byte
+		var albumID sql.NullInt64
+		var genre, mbTrackID, mbReleaseTrackID, mbArtistID sql.NullString
+		var added sql.NullFloat64
+
+		item := &beetsItem{}
+		err := rows.Scan(&item.ID, &path, &albumID, &genre, &mbTrackID, &mbReleaseTrackID, &mbArtistID, &added)
+		if err != nil {
+			return nil, err
+		}
+
+		// beets stores paths as bytes
+		item.Path = string(path)
+		item.AlbumID = albumID.Int64
+		item.Genre = genre.String
+		item.MBTrackID = mbTrackID.String
+		item.MBReleaseTrackID = mbReleaseTrackID.String
+		item.MBArtistID = mbArtistID.String
+		item.Added = added.Float64
+
+		items = append(items, item)
+		byID[item.ID] = item
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	attrs, err := beetsAttributes(beets, "item_attributes")
+	if err != nil {
+		return nil, err
+	}
+
+	for id, a := range attrs {
+		if item, ok := byID[id]; ok {
+			item.Attributes = a
+		}
+	}
+
+	return items, nil
+}
+
+func beetsAlbums(beets *sql.DB) ([]*beetsAlbum, error) {
+	rows, err := beets.Query(`SELECT id, genre, mb_albumid, mb_releasegroupid,
+		mb_albumartistid, added FROM albums`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var albums []*beetsAlbum
+	byID := make(map[int64]*beetsAlbum)
+	for rows.Next() {
+		var genre, mbAlbumID, mbReleaseGroupID, mbAlbumArtistID sql.NullString
+		var added sql.NullFloat64
+
+		album := &beetsAlbum{}
+		err := rows.Scan(&album.ID, &genre, &mbAlbumID, &mbReleaseGroupID, &mbAlbumArtistID, &added)
+		if err != nil {
+			return nil, err
+		}
+
+		album.Genre = genre.String
+		album.MBAlbumID = mbAlbumID.String
+		album.MBReleaseGroupID = mbReleaseGroupID.String
+		album.MBAlbumArtistID = mbAlbumArtistID.String
+		album.Added = added.Float64
+
+		albums = append(albums, album)
+		byID[album.ID] = album
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	attrs, err := beetsAttributes(beets, "album_attributes")
+	if err != nil {
+		return nil, err
+	}
+
+	for id, a := range attrs {
+		if album, ok := byID[id]; ok {
+			album.Attributes = a
+		}
+	}
+
+	return albums, nil
+}
+
+// beetsAttributes returns the flexible attributes in table by entity ID.
+func beetsAttributes(beets *sql.DB, table string) (map[int64]map[string]string, error) {
+	rows, err := beets.Query(fmt.Sprintf("SELECT entity_id, key, value FROM %s", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attrs := make(map[int64]map[string]string)
+	for rows.Next() {
+		var id int64
+		var key string
+		var value sql.NullString
+		if err := rows.Scan(&id, &key, &value); err != nil {
+			return nil, err
+		}
+
+		if attrs[id] == nil {
+			attrs[id] = make(map[string]string)
+		}
+		attrs[id][key] = value.String
+	}
+
+	return attrs, rows.Err()
+}
@@ -0,0 +1,107 @@
+package importer
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/cjlucas/tenor/db"
+)
+
+// durationTolerance is the largest difference in seconds between a
+// track's duration and an entry's for them to be matched by tags
+const durationTolerance = 2
+
+// PathRewrite replaces the Old prefix of a path with New, for libraries
+// whose files were at a different location than tenor's.
+type PathRewrite struct {
+	Old string
+	New string
+}
+
+// PathRewrites is a flag.Value that adds a PathRewrite, given as old=new,
+// each time the flag is set.
+type PathRewrites []PathRewrite
+
+func (r *PathRewrites) String() string {
+	return fmt.Sprint(*r)
+}
+
+func (r *PathRewrites) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("rewrite must be old=new: %s", value)
+	}
+
+	*r = append(*r, PathRewrite{Old: parts[0], New: parts[1]})
+	return nil
+}
+
+// Report is the result of an import.
+type Report struct {
+	Total         int
+	MatchedByPath int
+	MatchedByTags int
+	// Unmatched describes each entry that didn't match a track
+	Unmatched []string
+}
+
+func rewritePath(fpath string, rewrites []PathRewrite) string {
+	for _, r := range rewrites {
+		if strings.HasPrefix(fpath, r.Old) {
+			return filepath.Clean(r.New + strings.TrimPrefix(fpath, r.Old))
+		}
+	}
+
+	return filepath.Clean(fpath)
+}
+
+type matchedTrack struct {
+	ID       string
+	Duration float64
+}
+
+// trackByPath returns the ID of the track of the file at fpath, or an
+// empty string if there isn't one.
+func trackByPath(dal *db.DB, fpath string) (string, error) {
+	var tracks []matchedTrack
+	err := dal.Raw(`SELECT tracks.id FROM tracks
+		JOIN files ON files.id = tracks.file_id
+		WHERE files.path = ?`, fpath).Scan(&tracks)
+	if err != nil || len(tracks) != 1 {
+		return "", err
+	}
+
+	return tracks[0].ID, nil
+}
+
+// trackByTags returns the ID of the only track with the given name, artist
+// and album whose duration is within durationTolerance, or an empty string
+// if there isn't exactly one.
+func trackByTags(dal *db.DB, name, artist, album string, duration float64) (string, error) {
+	var tracks []matchedTrack
+	err := dal.Raw(`SELECT tracks.id, tracks.duration FROM tracks
+		JOIN artists ON artists.id = tracks.artist_id
+		JOIN albums ON albums.id = tracks.album_id
+		WHERE tracks.name = ? COLLATE NOCASE
+		AND artists.normalized_name = ?
+		AND albums.name = ? COLLATE NOCASE`, name, db.NormalizeName(artist), album).Scan(&tracks)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	for _, t := range tracks {
+		if math.Abs(t.Duration-duration) > durationTolerance {
+			continue
+		}
+
+		if id != "" {
+			return "", nil
+		}
+		id = t.ID
+	}
+
+	return id, nil
+}
@@ -0,0 +1,200 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/cjlucas/tenor/db"
+)
+
+// ITunesSource is the source of plays imported from iTunes
+const ITunesSource = "itunes"
+
+// ITunesTrack is an entry of the Tracks dict of an iTunes or Music
+// Library.xml.
+type ITunesTrack struct {
+	Name   string
+	Artist string
+	Album  string
+	// TotalTime is the duration in milliseconds
+	TotalTime int64
+
+	PlayCount    int64
+	PlayDateUTC  time.Time
+	Rating       int64
+	RatingIsAuto bool
+	DateAdded    time.Time
+
+	Location string
+}
+
+// Path returns the path of the track's file, or an empty string if it
+// isn't a local file.
+func (t *ITunesTrack) Path() string {
+	u, err := url.Parse(t.Location)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+
+	return u.Path
+}
+
+// ParseITunesLibrary returns the tracks of an iTunes or Music Library.xml.
+func ParseITunesLibrary(r io.Reader) ([]ITunesTrack, error) {
+	plist, err := decodePlist(r)
+	if err != nil {
+		return nil, err
+	}
+
+	library, ok := plist.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("library is not a dict")
+	}
+
+	entries, ok := library["Tracks"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("library has no tracks")
+	}
+
+	var tracks []ITunesTrack
+	for _, entry := range entries {
+		dict, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var t ITunesTrack
+		t.Name, _ = dict["Name"].(string)
+		t.Artist, _ = dict["Artist"].(string)
+		t.Album, _ = dict["Album"].(string)
+		t.TotalTime, _ = dict["Total Time"].(int64)
+		t.PlayCount, _ = dict["Play Count"].(int64)
+		t.PlayDateUTC, _ = dict["Play Date UTC"].(time.Time)
+		t.Rating, _ = dict["Rating"].(int64)
+		t.RatingIsAuto, _ = dict["Rating Computed"].(bool)
+		t.DateAdded, _ = dict["Date Added"].(time.Time)
+		t.Location, _ = dict["Location"].(string)
+
+		tracks = append(tracks, t)
+	}
+
+	return tracks, nil
+}
+
+// ITunesImporter imports play counts, ratings and dates added from an
+// iTunes or Music library. Entries are matched to tracks by path, then by
+// name, artist, album and duration.
+type ITunesImporter struct {
+	DB       *db.DB
+	Rewrites []PathRewrite
+	// DryRun matches entries without importing anything
+	DryRun bool
+}
+
+func (i *ITunesImporter) Import(r io.Reader) (*Report, error) {
+	tracks, err := ParseITunesLibrary(r)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	err = i.DB.Transaction(func(tx *db.DB) error {
+		for _, t := range tracks {
+			report.Total++
+
+			// Entries without a local file, such as streamed or cloud
+			// tracks, can still match by tags
+			var id string
+			var err error
+			fpath := t.Path()
+			if fpath != "" {
+				fpath = rewritePath(fpath, i.Rewrites)
+
+				if id, err = trackByPath(tx, fpath); err != nil {
+					return err
+				}
+			}
+
+			if id != "" {
+				report.MatchedByPath++
+			} else {
+				duration := float64(t.TotalTime) / 1000
+				id, err = trackByTags(tx, t.Name, t.Artist, t.Album, duration)
+				if err != nil {
+					return err
+				}
+
+				if id == "" {
+					entry := fmt.Sprintf("%s - %s - %s", t.Artist, t.Album, t.Name)
+					if fpath != "" {
+						entry += " (" + fpath + ")"
+					}
+
+					report.Unmatched = append(report.Unmatched, entry)
+					continue
+				}
+				report.MatchedByTags++
+			}
+
+			if i.DryRun {
+				continue
+			}
+
+			if err := i.importTrack(tx, id, &t); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func (i *ITunesImporter) importTrack(tx *db.DB, trackID string, t *ITunesTrack) error {
+	// Replace the plays of any previous import
+	err := tx.Exec("DELETE FROM plays WHERE track_id = ? AND source = ?", trackID, ITunesSource)
+	if err != nil {
+		return err
+	}
+
+	if t.PlayCount > 0 {
+		play := db.Play{
+			TrackID:  trackID,
+			PlayedAt: t.PlayDateUTC,
+			Count:    int(t.PlayCount),
+			Source:   ITunesSource,
+		}
+		if err := tx.Plays.Create(&play); err != nil {
+			return err
+		}
+	}
+
+	// Computed ratings are derived from the album's rating
+	if t.Rating > 0 && !t.RatingIsAuto {
+		rating := db.Rating{TrackID: trackID}
+		if err := tx.Ratings.FirstOrCreate(&rating); err != nil {
+			return err
+		}
+
+		rating.Value = int(t.Rating)
+		if err := tx.Ratings.Update(&rating); err != nil {
+			return err
+		}
+	}
+
+	if !t.DateAdded.IsZero() {
+		err := tx.Exec("UPDATE tracks SET created_at = ? WHERE id = ? AND created_at > ?", t.DateAdded, trackID, t.DateAdded)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package importer
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decodePlist decodes an XML property list. Dicts are decoded as
+// map[string]interface{}, arrays as []interface{}, integers as int64,
+// reals as float64, dates as time.Time, data as []byte and booleans
+// as bool.
+func decodePlist(r io.Reader) (interface{}, error) {
+	d := xml.NewDecoder(r)
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "plist" {
+			return decodePlistValue(d, nil)
+		}
+	}
+}
+
+// decodePlistValue decodes the next value, or the value started by start
+// if it isn't nil.
+func decodePlistValue(d *xml.Decoder, start *xml.StartElement) (interface{}, error) {
+	for start == nil {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		if s, ok := tok.(xml.StartElement); ok {
+			start = &s
+		}
+	}
+
+	switch start.Name.Local {
+	case "dict":
+		return decodePlistDict(d)
+	case "array":
+		return decodePlistArray(d)
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := d.DecodeElement(&text, start); err != nil {
+		return nil, err
+	}
+
+	switch start.Name.Local {
+	case "string", "key":
+		return text, nil
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	case "real":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	case "date":
+		return time.Parse(time.RFC3339, strings.TrimSpace(text))
+	case "data":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	}
+
+	return nil, fmt.Errorf("unknown plist element: %s", start.Name.Local)
+}
+
+func decodePlistDict(d *xml.Decoder) (map[string]interface{}, error) {
+	dict := make(map[string]interface{})
+
+	var key string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			return dict, nil
+		case xml.StartElement:
+			if tok.Name.Local == "key" {
+				if err := d.DecodeElement(&key, &tok); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			val, err := decodePlistValue(d, &tok)
+			if err != nil {
+				return nil, err
+			}
+			dict[key] = val
+		}
+	}
+}
+
+func decodePlistArray(d *xml.Decoder) ([]interface{}, error) {
+	var array []interface{}
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			return array, nil
+		case xml.StartElement:
+			val, err := decodePlistValue(d, &tok)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, val)
+		}
+	}
+}
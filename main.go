@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	_ "image/jpeg"
 	_ "image/png"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/cjlucas/tenor/api"
@@ -14,6 +20,14 @@ import (
 )
 
 func main() {
+	force := flag.Bool("force", false, "rescan all files, including those that are unchanged")
+	followSymlinks := flag.Bool("follow-symlinks", false, "scan symlinked files and directories within the library")
+	artworkURI := flag.String("artwork", ".images", "directory or s3:// URL to store artwork in")
+	poll := flag.Duration("poll", 0, "poll for changes at this interval instead of watching for filesystem events")
+	rootsPath := flag.String("roots", "roots.json", "JSON file listing the library roots to scan")
+	parserWorkers := flag.Int("parser-workers", 0, "number of files to parse concurrently (defaults to the number of CPUs)")
+	flag.Parse()
+
 	dal, err := db.Open("dev.db")
 	if err != nil {
 		panic(err)
@@ -21,24 +35,91 @@ func main() {
 
 	searchService := search.NewService(dal)
 
-	artworkStore := artwork.NewStore(".images")
+	artworkStore, err := artwork.OpenStore(*artworkURI)
+	if err != nil {
+		panic(err)
+	}
+
+	// Without any roots, nothing is scanned but the library is still served
+	libraryRoots, err := scanner.LoadLibraryRoots(*rootsPath)
+	if os.IsNotExist(err) {
+		fmt.Println("No library roots configured,", *rootsPath, "does not exist")
+	} else if err != nil {
+		panic(err)
+	}
+
+	if err := scanner.SyncLibraryRoots(dal, libraryRoots); err != nil {
+		panic(err)
+	}
 
 	scannerService := scanner.NewService(dal, artworkStore, scanner.ServiceConfig{
-		BatchDelay:   5 * time.Second,
-		MaxBatchSize: 500,
+		BatchDelay:     5 * time.Second,
+		MaxBatchSize:   500,
+		FollowSymlinks: *followSymlinks,
+		Scanner: scanner.ScannerConfig{
+			LibraryRoots: libraryRoots,
+			PathTemplates: []*scanner.PathTemplate{
+				scanner.MustParsePathTemplate("{albumartist}/{year} - {album}/{disc}-{track} {title}"),
+				scanner.MustParsePathTemplate("{albumartist}/{album}/{track} {title}"),
+			},
+			ArtworkFilenames: scanner.DefaultArtworkFilenames,
+			ParserWorkers:    *parserWorkers,
+		},
 	})
 
-	go scannerService.Run()
+	ctx, cancel := context.WithCancel(context.Background())
 
-	scannerService.RegisterProvider(&scanner.SingleScanProvider{
-		Dir: "/Volumes/RAID/music",
-	})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		fmt.Println("Received", sig, "shutting down")
+		cancel()
+	}()
 
-	scannerService.RegisterProvider(&scanner.FSWatchProvider{
-		Dir: "/Volumes/RAID/music",
-	})
+	scannerDone := make(chan interface{})
+	go func() {
+		scannerService.Run(ctx)
+		close(scannerDone)
+	}()
+
+	for _, root := range libraryRoots {
+		if root.Disabled {
+			continue
+		}
+
+		scannerService.RegisterProvider(&scanner.SingleScanProvider{
+			Dir:            root.Path,
+			Force:          *force,
+			FollowSymlinks: *followSymlinks,
+		})
+
+		if *poll > 0 {
+			scannerService.RegisterProvider(&scanner.PollingProvider{
+				Dir:      root.Path,
+				DB:       dal,
+				Interval: *poll,
+			})
+		} else {
+			scannerService.RegisterProvider(&scanner.FSWatchProvider{
+				Dir: root.Path,
+			})
+		}
+	}
 
-	apiService := api.NewService(dal, artworkStore, searchService)
+	apiService := api.NewService(dal, artworkStore, searchService, scannerService)
 
-	apiService.Run()
+	if err := apiService.Run(ctx); err != nil {
+		fmt.Println("Error running API:", err)
+	}
+
+	// The API may have stopped on its own
+	cancel()
+	<-scannerDone
+
+	searchService.Close()
+
+	if err := dal.Close(); err != nil {
+		fmt.Println("Error closing database:", err)
+	}
 }
@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cjlucas/tenor/artwork"
+	"github.com/cjlucas/tenor/db"
+)
+
+type GCStats struct {
+	Artists int
+	Albums  int
+	Discs   int
+	Works   int
+	Images  int
+}
+
+// Each query selects the rows of a table that nothing references anymore.
+// Order matters, as removing discs and albums may orphan their artists.
+const (
+	orphanedDiscsQuery = `NOT EXISTS (SELECT 1 FROM tracks WHERE tracks.disc_id = discs.id)`
+
+	orphanedAlbumsQuery = `NOT EXISTS (SELECT 1 FROM tracks WHERE tracks.album_id = albums.id)
+		AND NOT EXISTS (SELECT 1 FROM discs WHERE discs.album_id = albums.id)`
+
+	orphanedWorksQuery = `NOT EXISTS (SELECT 1 FROM tracks WHERE tracks.work_id = works.id)`
+
+	orphanedArtistsQuery = `NOT EXISTS (SELECT 1 FROM tracks WHERE tracks.artist_id = artists.id)
+		AND NOT EXISTS (SELECT 1 FROM albums WHERE albums.artist_id = artists.id)
+		AND NOT EXISTS (SELECT 1 FROM track_credits WHERE track_credits.artist_id = artists.id)
+		AND NOT EXISTS (SELECT 1 FROM works WHERE works.artist_id = artists.id)`
+
+	orphanedImagesQuery = `NOT EXISTS (SELECT 1 FROM tracks WHERE tracks.image_id = images.id)
+		AND NOT EXISTS (SELECT 1 FROM albums WHERE albums.image_id = images.id)`
+
+	// %[1]s is the table of a track's data, see trackDataTables
+	orphanedTrackDataQuery = `NOT EXISTS (SELECT 1 FROM tracks WHERE tracks.id = %[1]s.track_id)
+		AND NOT EXISTS (SELECT 1 FROM removed_tracks WHERE removed_tracks.track_id = %[1]s.track_id)`
+
+	// Removed tracks may still be restored with their album's overrides
+	orphanedAlbumOverridesQuery = `NOT EXISTS (SELECT 1 FROM albums WHERE albums.id = album_overrides.album_id)
+		AND NOT EXISTS (SELECT 1 FROM removed_tracks WHERE removed_tracks.album_id = album_overrides.album_id)`
+
+	orphanedAttributesQuery = `NOT EXISTS (SELECT 1 FROM tracks WHERE tracks.id = attributes.owner_id)
+		AND NOT EXISTS (SELECT 1 FROM albums WHERE albums.id = attributes.owner_id)`
+)
+
+// removedTrackTTL is how long the data of a removed track is kept in case
+// its file reappears
+const removedTrackTTL = 30 * 24 * time.Hour
+
+// collectGarbage deletes artists, albums, discs, works, images, attributes
+// and album overrides that are no longer referenced, along with any artwork
+// without an image row. The overrides, plays and ratings of removed tracks,
+// and the overrides of their albums, are deleted once removedTrackTTL has
+// passed. The stats count what was deleted before any error.
+func collectGarbage(dal *db.DB, artworkStore artwork.Store) (GCStats, error) {
+	var stats GCStats
+
+	var discs []db.Disc
+	if err := dal.Discs.Where(orphanedDiscsQuery).All(&discs); err != nil {
+		return stats, err
+	}
+	for i := range discs {
+		if err := dal.Discs.Delete(&discs[i]); err != nil {
+			return stats, err
+		}
+		stats.Discs++
+	}
+
+	var albums []db.Album
+	if err := dal.Albums.Where(orphanedAlbumsQuery).All(&albums); err != nil {
+		return stats, err
+	}
+	for i := range albums {
+		if err := dal.Albums.Delete(&albums[i]); err != nil {
+			return stats, err
+		}
+		stats.Albums++
+	}
+
+	var works []db.Work
+	if err := dal.Works.Where(orphanedWorksQuery).All(&works); err != nil {
+		return stats, err
+	}
+	for i := range works {
+		if err := dal.Works.Delete(&works[i]); err != nil {
+			return stats, err
+		}
+		stats.Works++
+	}
+
+	var artists []db.Artist
+	if err := dal.Artists.Where(orphanedArtistsQuery).All(&artists); err != nil {
+		return stats, err
+	}
+	for i := range artists {
+		if err := dal.Artists.Delete(&artists[i]); err != nil {
+			return stats, err
+		}
+		stats.Artists++
+	}
+
+	var images []db.Image
+	if err := dal.Images.Where(orphanedImagesQuery).All(&images); err != nil {
+		return stats, err
+	}
+	for i := range images {
+		if err := dal.Images.Delete(&images[i]); err != nil {
+			return stats, err
+		}
+		stats.Images++
+	}
+
+	if err := dal.Exec("DELETE FROM attributes WHERE " + orphanedAttributesQuery); err != nil {
+		return stats, err
+	}
+
+	cutoff := time.Now().UTC().Add(-removedTrackTTL)
+	if err := dal.Exec("DELETE FROM removed_tracks WHERE created_at < ?", cutoff); err != nil {
+		return stats, err
+	}
+
+	for _, table := range trackDataTables {
+		query := fmt.Sprintf(orphanedTrackDataQuery, table)
+		if err := dal.Exec("DELETE FROM " + table + " WHERE " + query); err != nil {
+			return stats, err
+		}
+	}
+
+	if err := dal.Exec("DELETE FROM album_overrides WHERE " + orphanedAlbumOverridesQuery); err != nil {
+		return stats, err
+	}
+
+	// Artwork is only swept once every image row is known, otherwise all
+	// of it would look unreferenced
+	var checksums []string
+	if err := dal.Images.Pluck("checksum", &checksums); err != nil {
+		return stats, err
+	}
+
+	keys, err := artworkStore.Keys()
+	if err != nil {
+		return stats, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, csum := range checksums {
+		referenced[csum] = true
+	}
+
+	for _, key := range keys {
+		if referenced[key] {
+			continue
+		}
+
+		if err := artworkStore.DeleteImage(key); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,182 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// Job states
+const (
+	JobRunningState  = "running"
+	JobFinishedState = "finished"
+)
+
+// finishedJobTTL is how long finished jobs can be polled for
+const finishedJobTTL = time.Hour
+
+// Job is a snapshot of an on-demand scan.
+type Job struct {
+	ID    string
+	State string
+
+	// Files is the number of files found so far
+	Files     int
+	Processed int
+
+	CreatedAt  time.Time
+	FinishedAt time.Time
+}
+
+type scanJob struct {
+	Job
+
+	pending map[string]bool
+	// walked is set once every file has been found
+	walked bool
+}
+
+func (j *scanJob) finishIfDone() {
+	if j.walked && len(j.pending) == 0 && j.State != JobFinishedState {
+		j.State = JobFinishedState
+		j.FinishedAt = time.Now()
+	}
+}
+
+// jobTracker follows the files of each job through the scanner.
+// It's safe for concurrent use.
+type jobTracker struct {
+	lock sync.Mutex
+	jobs map[string]*scanJob
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{
+		jobs: make(map[string]*scanJob),
+	}
+}
+
+func (t *jobTracker) newJob() *scanJob {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for id, job := range t.jobs {
+		if job.State == JobFinishedState && time.Since(job.FinishedAt) > finishedJobTTL {
+			delete(t.jobs, id)
+		}
+	}
+
+	job := &scanJob{
+		Job: Job{
+			ID:        uuid.NewV4().String(),
+			State:     JobRunningState,
+			CreatedAt: time.Now(),
+		},
+		pending: make(map[string]bool),
+	}
+	t.jobs[job.ID] = job
+
+	return job
+}
+
+func (t *jobTracker) Job(id string) (Job, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	job, ok := t.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return job.Job, true
+}
+
+func (t *jobTracker) addFile(job *scanJob, fpath string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !job.pending[fpath] {
+		job.pending[fpath] = true
+		job.Files++
+	}
+}
+
+func (t *jobTracker) walked(job *scanJob) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	job.walked = true
+	job.finishIfDone()
+}
+
+// filesScanned is called with every batch once it has been scanned.
+func (t *jobTracker) filesScanned(fpaths []string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, job := range t.jobs {
+		if job.State == JobFinishedState {
+			continue
+		}
+
+		for _, fpath := range fpaths {
+			if job.pending[fpath] {
+				delete(job.pending, fpath)
+				job.Processed++
+			}
+		}
+
+		job.finishIfDone()
+	}
+}
+
+// jobProvider rescans every file within Paths for a job, then deregisters.
+type jobProvider struct {
+	Paths          []string
+	FollowSymlinks bool
+
+	handler Handler
+	jobs    *jobTracker
+	job     *scanJob
+}
+
+func (p *jobProvider) SetHandler(h Handler) {
+	p.handler = h
+}
+
+func (p *jobProvider) Run(ctx context.Context) {
+	for _, root := range p.Paths {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			p.jobs.addFile(p.job, root)
+			p.handler.RemoveFile(root)
+			continue
+		}
+
+		walk(root, p.FollowSymlinks, func(fpath string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if !isAudioFile(fpath) {
+				return nil
+			}
+
+			// The file is added to the job first so the job can't
+			// miss it being scanned
+			p.jobs.addFile(p.job, fpath)
+			p.handler.RescanFile(fpath)
+
+			return nil
+		})
+	}
+
+	p.jobs.walked(p.job)
+	p.handler.DeregisterProvider(p)
+}
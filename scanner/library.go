@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cjlucas/tenor/db"
+)
+
+// libraryRootConfig is a library root as it's written in a config file.
+type libraryRootConfig struct {
+	Name     string   `json:"name"`
+	Path     string   `json:"path"`
+	Include  []string `json:"include"`
+	Exclude  []string `json:"exclude"`
+	Disabled bool     `json:"disabled"`
+}
+
+// LoadLibraryRoots reads library roots from a JSON file containing an
+// array of objects with name, path, include, exclude and disabled keys.
+// Only path is required.
+func LoadLibraryRoots(fpath string) ([]*db.LibraryRoot, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var configs []libraryRootConfig
+	if err := json.NewDecoder(f).Decode(&configs); err != nil {
+		return nil, fmt.Errorf("%s: %s", fpath, err)
+	}
+
+	var roots []*db.LibraryRoot
+	for i, cfg := range configs {
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("%s: library root %d has no path", fpath, i+1)
+		}
+
+		roots = append(roots, &db.LibraryRoot{
+			Name:     cfg.Name,
+			Path:     cfg.Path,
+			Include:  cfg.Include,
+			Exclude:  cfg.Exclude,
+			Disabled: cfg.Disabled,
+		})
+	}
+
+	return roots, nil
+}
+
+// SyncLibraryRoots saves the given roots, keyed by path, and sets their IDs.
+// Roots must be synced before they're given to a Scanner.
+func SyncLibraryRoots(dal *db.DB, roots []*db.LibraryRoot) error {
+	for _, root := range roots {
+		cfg := *root
+		cfg.Path = filepath.Clean(cfg.Path)
+		root.Path = cfg.Path
+
+		if err := dal.LibraryRoots.FirstOrCreate(root); err != nil {
+			return err
+		}
+
+		root.Name = cfg.Name
+		root.Include = cfg.Include
+		root.Exclude = cfg.Exclude
+		root.Disabled = cfg.Disabled
+
+		if err := dal.LibraryRoots.Update(root); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// libraryRootFor returns the root with the longest path containing fpath.
+func libraryRootFor(roots []*db.LibraryRoot, fpath string) *db.LibraryRoot {
+	var match *db.LibraryRoot
+	for _, root := range roots {
+		if fpath != root.Path && !strings.HasPrefix(fpath, root.Path+"/") {
+			continue
+		}
+
+		if match == nil || len(root.Path) > len(match.Path) {
+			match = root
+		}
+	}
+
+	return match
+}
+
+// matchesGlob reports whether pattern matches any run of consecutive
+// components of the relative path rel. This allows "*/Incomplete/*" to
+// match at any depth and ".AppleDouble" to match a directory anywhere
+// in the path.
+func matchesGlob(pattern string, rel string) bool {
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		for j := i + 1; j <= len(parts); j++ {
+			if ok, _ := filepath.Match(pattern, strings.Join(parts[i:j], "/")); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// rootIncludes reports whether fpath, which must be within root, passes the
+// root's include and exclude patterns. Files are included by default if the
+// root doesn't have any include patterns.
+func rootIncludes(root *db.LibraryRoot, fpath string) bool {
+	rel := strings.TrimPrefix(strings.TrimPrefix(fpath, root.Path), "/")
+	if rel == "" {
+		return true
+	}
+
+	for _, pattern := range root.Exclude {
+		if matchesGlob(pattern, rel) {
+			return false
+		}
+	}
+
+	if len(root.Include) == 0 {
+		return true
+	}
+
+	for _, pattern := range root.Include {
+		if matchesGlob(pattern, rel) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/cjlucas/tenor/audio"
+	"github.com/cjlucas/tenor/db"
+)
+
+// ValidateOverride returns an error if field can't be overridden or value
+// isn't valid for it. Overridable fields are the same as the fields of a
+// PathTemplate.
+func ValidateOverride(field string, value string) error {
+	switch field {
+	case TitleField, ArtistField, AlbumArtistField, AlbumField:
+		return nil
+	case TrackField, YearField, DiscField:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%s must be a number", field)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown field: %s", field)
+}
+
+// ValidateAlbumOverride is ValidateOverride for the fields shared by the
+// tracks of an album.
+func ValidateAlbumOverride(field string, value string) error {
+	switch field {
+	case AlbumArtistField, AlbumField, YearField:
+		return ValidateOverride(field, value)
+	}
+
+	return fmt.Errorf("%s can't be overridden for an album", field)
+}
+
+// applyOverrides returns metadata with the overrides' values in place of
+// the tags, along with the list of fields that were overridden. A track's
+// overrides take precedence over its album's.
+func applyOverrides(metadata audio.Metadata, albumOverrides []db.AlbumOverride, overrides []db.Override) (audio.Metadata, db.StringList) {
+	if len(albumOverrides) == 0 && len(overrides) == 0 {
+		return metadata, nil
+	}
+
+	overridden := &fieldMetadata{
+		Metadata: metadata,
+		fields:   make(map[string]string),
+	}
+
+	for _, o := range albumOverrides {
+		if ValidateAlbumOverride(o.Field, o.Value) == nil {
+			overridden.fields[o.Field] = o.Value
+		}
+	}
+
+	for _, o := range overrides {
+		if ValidateOverride(o.Field, o.Value) == nil {
+			overridden.fields[o.Field] = o.Value
+		}
+	}
+
+	var fields db.StringList
+	for field := range overridden.fields {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	return overridden, fields
+}
+
+// hasField reports whether field is in list.
+func hasField(list db.StringList, field string) bool {
+	for _, f := range list {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withoutFields returns the fields in list that aren't in remove.
+func withoutFields(list db.StringList, remove db.StringList) db.StringList {
+	var out db.StringList
+	for _, field := range list {
+		if !hasField(remove, field) {
+			out = append(out, field)
+		}
+	}
+
+	return out
+}
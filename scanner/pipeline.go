@@ -0,0 +1,197 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"image"
+	"runtime"
+	"sync"
+
+	"github.com/cjlucas/tenor/artwork"
+	"github.com/cjlucas/tenor/audio"
+	"github.com/cjlucas/tenor/db"
+)
+
+type imageData struct {
+	Data     []byte
+	Checksum string
+	MIMEType string
+	Width    int
+	Height   int
+}
+
+// newImageData returns nil if data isn't a supported image. Only the
+// image's header is decoded, see Scanner.loadPalette.
+func newImageData(data []byte) *imageData {
+	cfg, imgType, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	var mimeType string
+	switch imgType {
+	case "png":
+		mimeType = "image/png"
+	case "jpeg":
+		mimeType = "image/jpeg"
+	}
+
+	csum := md5.Sum(data)
+
+	return &imageData{
+		Data:     data,
+		Checksum: fmt.Sprintf("%x", csum[:]),
+		MIMEType: mimeType,
+		Width:    cfg.Width,
+		Height:   cfg.Height,
+	}
+}
+
+// imagePalettes holds the palettes of a batch's images, keyed by checksum,
+// so each image is decoded at most once even though the same artwork is
+// usually embedded in many files. It's safe for concurrent use.
+type imagePalettes struct {
+	sync.Mutex
+	palettes map[string]artwork.Palette
+}
+
+// claim reports whether the caller should extract the palette of the image
+// with the given checksum, which is only true the first time it's asked.
+func (p *imagePalettes) claim(checksum string) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	if _, ok := p.palettes[checksum]; ok {
+		return false
+	}
+	p.palettes[checksum] = artwork.Palette{}
+
+	return true
+}
+
+func (p *imagePalettes) set(checksum string, palette artwork.Palette) {
+	p.Lock()
+	p.palettes[checksum] = palette
+	p.Unlock()
+}
+
+func (p *imagePalettes) get(checksum string) artwork.Palette {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.palettes[checksum]
+}
+
+// loadPalette extracts the image's palette, unless it's been extracted
+// already or the image is already stored with one.
+func (s *Scanner) loadPalette(img *imageData) {
+	if !s.palettes.claim(img.Checksum) {
+		return
+	}
+
+	var stored []db.Image
+	err := s.db.Images.
+		Where("checksum = ? AND dominant_color != ''", img.Checksum).
+		Limit(1).
+		All(&stored)
+	if err == nil && len(stored) > 0 {
+		return
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return
+	}
+
+	s.palettes.set(img.Checksum, artwork.ExtractPalette(decoded))
+}
+
+type parseResult struct {
+	Metadata       audio.Metadata
+	InferredFields db.StringList
+	Image          *imageData
+	Err            error
+}
+
+// parseFile does all the work for a file that doesn't touch the database,
+// so it can safely run concurrently.
+func parseFile(fpath string, templates []*PathTemplate) *parseResult {
+	metadata, err := audio.ParseFile(fpath)
+	if err != nil {
+		return &parseResult{Err: err}
+	}
+
+	metadata, inferredFields := inferMetadata(metadata, fpath, templates)
+
+	res := &parseResult{
+		Metadata:       metadata,
+		InferredFields: inferredFields,
+	}
+
+	if images := metadata.Images(); len(images) > 0 {
+		res.Image = newImageData(images[0])
+	}
+
+	return res
+}
+
+// parseFiles parses fpaths using a pool of workers and calls fn with each
+// result, in the same order as fpaths, on the calling goroutine. This keeps
+// database writes serialized while parsing runs concurrently. Workers are
+// only allowed to get a few files ahead of fn to bound memory usage.
+// Parsing stops at the first error returned by fn.
+func (s *Scanner) parseFiles(fpaths []string, fn func(i int, res *parseResult) error) error {
+	numWorkers := s.config.ParserWorkers
+	if numWorkers < 1 {
+		numWorkers = runtime.NumCPU()
+	}
+
+	results := make([]chan *parseResult, len(fpaths))
+	for i := range results {
+		results[i] = make(chan *parseResult, 1)
+	}
+
+	jobs := make(chan int)
+	window := make(chan struct{}, numWorkers*2)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(jobs)
+
+		for i := range fpaths {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			jobs <- i
+		}
+	}()
+
+	for n := 0; n < numWorkers; n++ {
+		go func() {
+			for i := range jobs {
+				res := parseFile(fpaths[i], s.config.PathTemplates)
+				if res.Image != nil {
+					s.loadPalette(res.Image)
+				}
+
+				results[i] <- res
+			}
+		}()
+	}
+
+	for i := range fpaths {
+		res := <-results[i]
+		<-window
+
+		if err := fn(i, res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
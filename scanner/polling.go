@@ -0,0 +1,223 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cjlucas/tenor/db"
+)
+
+const (
+	DefaultPollInterval     = time.Minute
+	DefaultFullPollInterval = time.Hour
+)
+
+type polledFile struct {
+	Size  int64
+	MTime time.Time
+}
+
+type polledDir struct {
+	MTime time.Time
+	Files []string
+	Dirs  []string
+}
+
+// PollingProvider finds changes by periodically listing Dir and comparing
+// it to the previous listing. It's meant for network filesystems, which
+// don't support filesystem events.
+//
+// The files of a directory whose mtime hasn't changed are assumed to be
+// unchanged, which misses files modified in place. Every FullPollInterval
+// every file is checked regardless.
+type PollingProvider struct {
+	Dir string
+	// DB is used to find the files known before the first poll
+	DB *db.DB
+
+	Interval         time.Duration
+	FullPollInterval time.Duration
+
+	handler Handler
+
+	files    map[string]polledFile
+	dirs     map[string]polledDir
+	polled   bool
+	lastFull time.Time
+}
+
+func (p *PollingProvider) SetHandler(h Handler) {
+	p.handler = h
+}
+
+func (p *PollingProvider) Run(ctx context.Context) {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	fullInterval := p.FullPollInterval
+	if fullInterval <= 0 {
+		fullInterval = DefaultFullPollInterval
+	}
+
+	if err := p.loadFiles(); err != nil {
+		fmt.Println("Error loading files for polling:", err)
+	}
+
+	for {
+		full := time.Since(p.lastFull) >= fullInterval
+		if full {
+			p.lastFull = time.Now()
+		}
+
+		p.poll(ctx, full)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// loadFiles seeds the previous listing with the files table so changes
+// made while tenor wasn't running are found by the first poll.
+func (p *PollingProvider) loadFiles() error {
+	p.files = make(map[string]polledFile)
+	p.dirs = make(map[string]polledDir)
+
+	dir := filepath.Clean(p.Dir)
+	prefix := dir + "/"
+
+	var files []db.File
+	err := p.DB.Files.
+		Where("substr(path, 1, ?) = ?", len(prefix), prefix).
+		All(&files)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		p.files[f.Path] = polledFile{Size: f.Size, MTime: f.MTime}
+	}
+
+	return nil
+}
+
+func (p *PollingProvider) poll(ctx context.Context, full bool) {
+	files := make(map[string]polledFile)
+	dirs := make(map[string]polledDir)
+
+	p.pollDir(ctx, filepath.Clean(p.Dir), full, files, dirs)
+
+	// A partial listing can't be compared
+	if ctx.Err() != nil {
+		return
+	}
+
+	// An unmounted share looks like an empty directory
+	if len(files) == 0 && len(p.files) > 0 {
+		fmt.Println("No files found in", p.Dir, "skipping poll")
+		return
+	}
+
+	for fpath, f := range files {
+		prev, ok := p.files[fpath]
+		if ok && prev.Size == f.Size && prev.MTime.Equal(f.MTime) {
+			continue
+		}
+
+		// The files table doesn't include images, so they can only be
+		// compared to a previous poll
+		if isImageFile(fpath) && !p.polled {
+			continue
+		}
+
+		p.handler.ScanFile(fpath)
+	}
+
+	for fpath := range p.files {
+		if _, ok := files[fpath]; !ok {
+			p.handler.RemoveFile(fpath)
+		}
+	}
+
+	p.files = files
+	p.dirs = dirs
+	p.polled = true
+}
+
+func (p *PollingProvider) pollDir(ctx context.Context, dir string, full bool, files map[string]polledFile, dirs map[string]polledDir) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		p.keepFiles(dir, files, err)
+		return
+	}
+
+	// If the mtime is unchanged nothing has been added or removed
+	prev, ok := p.dirs[dir]
+	if ok && !full && prev.MTime.Equal(info.ModTime()) {
+		for _, fpath := range prev.Files {
+			if f, ok := p.files[fpath]; ok {
+				files[fpath] = f
+			}
+		}
+
+		dirs[dir] = prev
+		for _, subdir := range prev.Dirs {
+			p.pollDir(ctx, subdir, full, files, dirs)
+		}
+
+		return
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		p.keepFiles(dir, files, err)
+		return
+	}
+
+	state := polledDir{MTime: info.ModTime()}
+	for _, entry := range entries {
+		fpath := filepath.Join(dir, entry.Name())
+
+		if entry.IsDir() {
+			state.Dirs = append(state.Dirs, fpath)
+			p.pollDir(ctx, fpath, full, files, dirs)
+			continue
+		}
+
+		if isAudioFile(fpath) || isImageFile(fpath) {
+			state.Files = append(state.Files, fpath)
+			files[fpath] = polledFile{Size: entry.Size(), MTime: entry.ModTime()}
+		}
+	}
+
+	dirs[dir] = state
+}
+
+// keepFiles keeps the previous listing of a directory that couldn't be
+// read rather than removing everything in it. The directory isn't added
+// to dirs so it's listed again by the next poll.
+func (p *PollingProvider) keepFiles(dir string, files map[string]polledFile, err error) {
+	fmt.Println("Error listing directory:", err)
+
+	prefix := dir + "/"
+	for fpath, f := range p.files {
+		if strings.HasPrefix(fpath, prefix) {
+			files[fpath] = f
+		}
+	}
+}
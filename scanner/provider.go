@@ -1,11 +1,13 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/rjeczalik/notify"
 )
@@ -17,18 +19,31 @@ func isAudioFile(fpath string) bool {
 }
 
 type Handler interface {
+	// ScanFile scans the file if it has changed since it was last scanned
 	ScanFile(fpath string)
+	// RescanFile scans the file regardless of whether it has changed
+	RescanFile(fpath string)
+	// RemoveFile removes the file, or the files within the directory, if
+	// the path no longer exists
+	RemoveFile(fpath string)
 	DeregisterProvider(Provider)
 }
 
 type Provider interface {
 	SetHandler(Handler)
-	Run()
+	// Run provides files to the Handler until ctx is done
+	Run(ctx context.Context)
 }
 
 type SingleScanProvider struct {
 	Dir string
 
+	// Force rescans every file, including those that are unchanged
+	Force bool
+
+	// FollowSymlinks walks symlinked files and directories
+	FollowSymlinks bool
+
 	handler Handler
 }
 
@@ -36,9 +51,19 @@ func (p *SingleScanProvider) SetHandler(h Handler) {
 	p.handler = h
 }
 
-func (p *SingleScanProvider) Run() {
-	filepath.Walk(p.Dir, func(fpath string, info os.FileInfo, err error) error {
-		if isAudioFile(fpath) {
+func (p *SingleScanProvider) Run(ctx context.Context) {
+	walk(p.Dir, p.FollowSymlinks, func(fpath string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !isAudioFile(fpath) {
+			return nil
+		}
+
+		if p.Force {
+			p.handler.RescanFile(fpath)
+		} else {
 			p.handler.ScanFile(fpath)
 		}
 
@@ -48,28 +73,156 @@ func (p *SingleScanProvider) Run() {
 	p.handler.DeregisterProvider(p)
 }
 
+// DefaultSettleTime is how long a file must be unchanged before
+// FSWatchProvider scans it.
+const DefaultSettleTime = 5 * time.Second
+
+// isTempFile reports whether fpath looks like a file that's still being
+// downloaded or written.
+func isTempFile(fpath string) bool {
+	ext := strings.ToLower(path.Ext(fpath))
+
+	return ext == ".part" || ext == ".tmp" || strings.HasSuffix(fpath, "~")
+}
+
+// maxRemovalDelay is how many settle windows a removal waits for the
+// settling files to be scanned.
+const maxRemovalDelay = 4
+
+type settlingFile struct {
+	Size        int64
+	MTime       time.Time
+	StableSince time.Time
+}
+
 type FSWatchProvider struct {
 	Dir string
 
+	// SettleTime is how long a file's size and mtime must hold steady
+	// before it's scanned, so files that are still being written aren't
+	// parsed. Defaults to DefaultSettleTime.
+	SettleTime time.Duration
+
 	handler Handler
+
+	settling map[string]*settlingFile
+	// removed holds the paths that no longer exist, by when they were
+	// removed, until the settling files have been scanned. A moved file
+	// is settling at its new path, and both paths must be queued together
+	// for the file to keep its track.
+	removed map[string]time.Time
 }
 
 func (p *FSWatchProvider) SetHandler(h Handler) {
 	p.handler = h
 }
 
-func (p *FSWatchProvider) Run() {
+func (p *FSWatchProvider) Run(ctx context.Context) {
+	settleTime := p.SettleTime
+	if settleTime <= 0 {
+		settleTime = DefaultSettleTime
+	}
+
+	p.settling = make(map[string]*settlingFile)
+	p.removed = make(map[string]time.Time)
+
 	c := make(chan notify.EventInfo, 50000)
 
 	watchPath := path.Join(p.Dir, "...")
 	notify.Watch(watchPath, c, notify.Create|notify.Write|notify.Rename|notify.Remove)
+	defer notify.Stop(c)
+
+	ticker := time.NewTicker(settleTime / 2)
+	defer ticker.Stop()
 
 	for {
-		event := <-c
-		fmt.Println(event)
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-c:
+			fmt.Println(event)
+			p.handleEvent(event)
+		case <-ticker.C:
+			p.checkSettled(settleTime)
+		}
+	}
+}
+
+func (p *FSWatchProvider) handleEvent(event notify.EventInfo) {
+	fpath := event.Path()
+	if isTempFile(fpath) {
+		return
+	}
+
+	info, err := os.Stat(fpath)
+	if err != nil {
+		// The path may be a directory that was removed or moved away
+		if os.IsNotExist(err) && event.Event()&(notify.Remove|notify.Rename) != 0 {
+			delete(p.settling, fpath)
+			p.removed[fpath] = time.Now()
+		}
+		return
+	}
+
+	// A directory that was moved in doesn't generate events for its contents
+	if info.IsDir() {
+		filepath.Walk(fpath, func(fpath string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				p.settle(fpath, info)
+			}
+			return nil
+		})
+		return
+	}
+
+	p.settle(fpath, info)
+}
+
+// settle starts or restarts the settle window of the file if it has changed.
+func (p *FSWatchProvider) settle(fpath string, info os.FileInfo) {
+	// Changes to images may affect an album's sidecar artwork
+	if isTempFile(fpath) || !(isAudioFile(fpath) || isImageFile(fpath)) {
+		return
+	}
+
+	f := p.settling[fpath]
+	if f != nil && f.Size == info.Size() && f.MTime.Equal(info.ModTime()) {
+		return
+	}
+
+	p.settling[fpath] = &settlingFile{
+		Size:        info.Size(),
+		MTime:       info.ModTime(),
+		StableSince: time.Now(),
+	}
+}
+
+func (p *FSWatchProvider) checkSettled(settleTime time.Duration) {
+	for fpath, f := range p.settling {
+		info, err := os.Stat(fpath)
+		if err != nil {
+			// A Remove event will follow if it was deleted
+			delete(p.settling, fpath)
+			continue
+		}
+
+		if info.Size() != f.Size || !info.ModTime().Equal(f.MTime) {
+			p.settle(fpath, info)
+			continue
+		}
+
+		if time.Since(f.StableSince) >= settleTime {
+			delete(p.settling, fpath)
+			p.handler.ScanFile(fpath)
+		}
+	}
 
-		if isAudioFile(event.Path()) {
-			p.handler.ScanFile(event.Path())
+	// Files that never settle, such as ones that are continuously written
+	// to, don't hold up removals forever
+	for fpath, removedAt := range p.removed {
+		if len(p.settling) == 0 || time.Since(removedAt) >= maxRemovalDelay*settleTime {
+			delete(p.removed, fpath)
+			p.handler.RemoveFile(fpath)
 		}
 	}
 }
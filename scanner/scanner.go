@@ -1,23 +1,24 @@
 package scanner
 
 import (
-	"bytes"
-	"crypto/md5"
-	"fmt"
-	"image"
+	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/cjlucas/tenor/artwork"
-	"github.com/cjlucas/tenor/audio"
 	"github.com/cjlucas/tenor/db"
 )
 
 type fileMetadata struct {
-	Path  string
-	Inode uint64
-	MTime time.Time
+	Path          string
+	Inode         uint64
+	Size          int64
+	MTime         time.Time
+	LibraryRootID string
 }
 
 type artistKey struct {
@@ -27,6 +28,30 @@ type artistKey struct {
 type albumKey struct {
 	ArtistKey artistKey
 	Name      string
+	// Dir is only set for compilations
+	Dir string
+}
+
+// albumGroupKey identifies the tracks that may make up a compilation
+type albumGroupKey struct {
+	Dir  string
+	Name string
+}
+
+type albumTrack struct {
+	TrackID        string
+	ArtistKey      artistKey
+	AlbumArtistKey artistKey
+	// AlbumArtistTagged is set if the album artist came from the tags or
+	// an override rather than the path
+	AlbumArtistTagged bool
+	Compilation       bool
+	// OverrideAlbumID is the album whose overrides were applied to the
+	// track, if any
+	OverrideAlbumID string
+
+	Album db.Album
+	Disc  db.Disc
 }
 
 type discKey struct {
@@ -34,63 +59,184 @@ type discKey struct {
 	Position int
 }
 
+type creditKey struct {
+	ArtistKey artistKey
+	Role      string
+}
+
+type workKey struct {
+	ComposerKey artistKey
+	Name        string
+}
+
+// maxChunkSize keeps IN (?) queries under SQLite's bound variable limit
+const maxChunkSize = 500
+
+func eachChunk(ids []string, fn func(ids []string) error) error {
+	for len(ids) > 0 {
+		max := maxChunkSize
+		if len(ids) < max {
+			max = len(ids)
+		}
+
+		if err := fn(ids[:max]); err != nil {
+			return err
+		}
+		ids = ids[max:]
+	}
+
+	return nil
+}
+
+type ScannerConfig struct {
+	// LibraryRoots limits the library to files within these roots that
+	// pass their include and exclude patterns. Roots must be saved with
+	// SyncLibraryRoots first. If empty, every scanned file is included.
+	LibraryRoots []*db.LibraryRoot
+
+	// PathTemplates are tried in order to fill in metadata missing
+	// from a file's tags.
+	PathTemplates []*PathTemplate
+
+	// ArtworkFilenames are glob patterns, in order of priority, of image
+	// files in an album's directory to use as its artwork.
+	ArtworkFilenames []string
+
+	// ParserWorkers is the number of files parsed concurrently.
+	// Defaults to the number of CPUs.
+	ParserWorkers int
+
+	// VariousArtistsName is the artist compilations are assigned to.
+	// Defaults to DefaultVariousArtistsName.
+	VariousArtistsName string
+}
+
+const DefaultVariousArtistsName = "Various Artists"
+
 type Scanner struct {
 	db           *db.DB
-	artworkStore *artwork.Store
+	artworkStore artwork.Store
+	config       ScannerConfig
 
 	artistCacne      map[artistKey][]string
 	albumArtistCache map[artistKey][]string
 	albumCache       map[albumKey][]string
 	discCache        map[discKey][]string
+	creditCache      map[creditKey][]string
+	workCache        map[workKey][]string
 	imageCache       map[string]string
+	sidecarCache     map[string]string
+
+	// albumOverrides caches the overrides of the albums the scanned
+	// tracks belonged to, keyed by album ID
+	albumOverrides map[string][]db.AlbumOverride
+	// overrideAlbums holds the IDs of the albums whose overrides were
+	// applied to each album's tracks
+	overrideAlbums map[albumKey]map[string]bool
+
+	// sidecarImages, savedArtwork and palettes are filled in before the
+	// batch's transaction starts
+	sidecarImages map[string]*imageData
+	savedArtwork  map[string]bool
+	palettes      *imagePalettes
+	// artworkMTimes caches when each directory's sidecar artwork last
+	// changed, see artworkChangedSince
+	artworkMTimes map[string]time.Time
+
+	// albumTracks holds the scanned tracks until they can be grouped
+	// into albums
+	albumTracks map[albumGroupKey][]albumTrack
+
+	trackIDs []string
+
+	// changed is set once the scan has modified the database
+	changed bool
+
+	// progress, if set, is called after each file is scanned
+	progress func(fpath string, err error)
 
 	albumModel map[albumKey]db.Album
 	discModel  map[discKey]db.Disc
 }
 
-func NewScanner(dal *db.DB, artworkStore *artwork.Store) *Scanner {
+func NewScanner(dal *db.DB, artworkStore artwork.Store, cfg ScannerConfig) *Scanner {
 	return &Scanner{
 		db:           dal,
 		artworkStore: artworkStore,
+		config:       cfg,
 
 		artistCacne:      make(map[artistKey][]string),
 		albumArtistCache: make(map[artistKey][]string),
 		albumCache:       make(map[albumKey][]string),
 		discCache:        make(map[discKey][]string),
+		creditCache:      make(map[creditKey][]string),
+		workCache:        make(map[workKey][]string),
 		imageCache:       make(map[string]string),
+		sidecarCache:     make(map[string]string),
+
+		albumOverrides: make(map[string][]db.AlbumOverride),
+		overrideAlbums: make(map[albumKey]map[string]bool),
+
+		sidecarImages: make(map[string]*imageData),
+		savedArtwork:  make(map[string]bool),
+		palettes:      &imagePalettes{palettes: make(map[string]artwork.Palette)},
+		artworkMTimes: make(map[string]time.Time),
+
+		albumTracks: make(map[albumGroupKey][]albumTrack),
 
 		albumModel: make(map[albumKey]db.Album),
 		discModel:  make(map[discKey]db.Disc),
 	}
 }
 
-func (s *Scanner) Scan(fpaths []string) error {
-	s.scanBatch(fpaths)
+// Scan parses the given files and updates the database. Files that are
+// unchanged since they were last scanned are skipped unless they're in forced.
+// Files are parsed before the batch is written in a single transaction,
+// which is rolled back if any error occurs, so the database isn't locked
+// while parsing.
+func (s *Scanner) Scan(fpaths []string, forced map[string]bool) error {
+	b, err := s.prepareBatch(fpaths, forced)
+	if err != nil {
+		return err
+	}
+
+	dal := s.db
+	defer func() { s.db = dal }()
+
+	return dal.Transaction(func(tx *db.DB) error {
+		s.db = tx
+
+		return s.scan(b)
+	})
+}
+
+func (s *Scanner) scan(b *batch) error {
+	if err := s.writeBatch(b); err != nil {
+		return err
+	}
+
+	if err := s.groupAlbums(); err != nil {
+		return err
+	}
 
 	artists := make(map[artistKey]*db.Artist)
 	for key, trackIDs := range s.artistCacne {
 		artist := db.Artist{Name: key.Name}
-		s.db.Artists.FirstOrCreate(&artist)
+		if err := s.db.Artists.FirstOrCreate(&artist); err != nil {
+			return err
+		}
 		artists[key] = &artist
 
-		for len(trackIDs) > 0 {
-			max := 500
-			if len(trackIDs) < max {
-				max = len(trackIDs)
-			}
-
-			ids := trackIDs[:max]
-			s.db.Exec("UPDATE tracks SET artist_id = ? WHERE id IN (?)", artist.ID, ids)
-			trackIDs = trackIDs[max:]
+		if err := s.updateTracks("artist_id", artist.ID, trackIDs); err != nil {
+			return err
 		}
 	}
 
 	albumArtists := make(map[artistKey]*db.Artist)
 	for key := range s.albumArtistCache {
-		artist := artists[key]
-		if artist == nil {
-			artist = &db.Artist{Name: key.Name}
-			s.db.Artists.FirstOrCreate(artist)
+		artist, err := s.lookupArtist(artists, key)
+		if err != nil {
+			return err
 		}
 		albumArtists[key] = artist
 	}
@@ -102,23 +248,54 @@ func (s *Scanner) Scan(fpaths []string) error {
 			panic("this should never happen")
 		}
 
-		album := s.albumModel[key]
-		album.ArtistID = artist.ID
+		model := s.albumModel[key]
+		model.ArtistID = artist.ID
 
-		s.db.Albums.FirstOrCreate(&album)
+		album := model
+		if err := s.db.Albums.FirstOrCreate(&album); err != nil {
+			return err
+		}
 		albums[key] = &album
 
-		for len(trackIDs) > 0 {
-			max := 500
-			if len(trackIDs) < max {
-				max = len(trackIDs)
+		// Release dates may have changed since the album was created,
+		// such as by an override of the year
+		changed := !album.ReleaseDate.Equal(model.ReleaseDate) ||
+			album.ReleaseDatePrecision != model.ReleaseDatePrecision
+		album.ReleaseDate = model.ReleaseDate
+		album.ReleaseDatePrecision = model.ReleaseDatePrecision
+
+		// The album's artwork is only removed once all of its tracks have
+		// been rescanned without finding any, since the tracks that weren't
+		// may have it embedded. Changes to sidecar artwork rescan the
+		// whole directory.
+		if album.ImageID != model.ImageID {
+			replace := model.ImageID != ""
+			if !replace {
+				var err error
+				if replace, err = s.isWholeAlbum(album.ID, trackIDs); err != nil {
+					return err
+				}
 			}
 
-			ids := trackIDs[:max]
-			s.db.Exec("UPDATE tracks SET album_id = ? WHERE id IN (?)", album.ID, ids)
-			trackIDs = trackIDs[max:]
+			if replace {
+				album.ImageID = model.ImageID
+				changed = true
+			}
+		}
+
+		if changed {
+			if err := s.db.Albums.Update(&album); err != nil {
+				return err
+			}
+		}
+
+		if err := s.applyAlbumOverrides(key, &album); err != nil {
+			return err
 		}
 
+		if err := s.updateTracks("album_id", album.ID, trackIDs); err != nil {
+			return err
+		}
 	}
 
 	for key, trackIDs := range s.discCache {
@@ -130,29 +307,314 @@ func (s *Scanner) Scan(fpaths []string) error {
 		disc := s.discModel[key]
 		disc.AlbumID = album.ID
 
-		s.db.Discs.FirstOrCreate(&disc)
+		if err := s.db.Discs.FirstOrCreate(&disc); err != nil {
+			return err
+		}
+
+		if err := s.updateTracks("disc_id", disc.ID, trackIDs); err != nil {
+			return err
+		}
+	}
+
+	// Credits are rebuilt from scratch for every scanned track
+	err := eachChunk(s.trackIDs, func(ids []string) error {
+		return s.db.Exec("DELETE FROM track_credits WHERE track_id IN (?)", ids)
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, trackIDs := range s.creditCache {
+		artist, err := s.lookupArtist(artists, key.ArtistKey)
+		if err != nil {
+			return err
+		}
+
+		for _, trackID := range trackIDs {
+			credit := db.TrackCredit{
+				Role:     key.Role,
+				TrackID:  trackID,
+				ArtistID: artist.ID,
+			}
+
+			if err := s.db.TrackCredits.Create(&credit); err != nil {
+				return err
+			}
+		}
+	}
+
+	for key, trackIDs := range s.workCache {
+		var composerID string
+		if key.ComposerKey.Name != "" {
+			composer, err := s.lookupArtist(artists, key.ComposerKey)
+			if err != nil {
+				return err
+			}
+			composerID = composer.ID
+		}
+
+		work := db.Work{Name: key.Name, ArtistID: composerID}
+		if err := s.db.Works.FirstOrCreate(&work); err != nil {
+			return err
+		}
+
+		if err := s.updateTracks("work_id", work.ID, trackIDs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isWholeAlbum reports whether trackIDs includes every track of the album.
+func (s *Scanner) isWholeAlbum(albumID string, trackIDs []string) (bool, error) {
+	var others []string
+	err := s.db.Tracks.
+		Where("album_id = ? AND id NOT IN (?)", albumID, trackIDs).
+		Limit(1).
+		Pluck("id", &others)
 
-		for len(trackIDs) > 0 {
-			max := 500
-			if len(trackIDs) < max {
-				max = len(trackIDs)
+	return len(others) == 0, err
+}
+
+// applyAlbumOverrides keeps the album overrides that were applied to the
+// album's tracks with the album, which may not be the album the overrides
+// belonged to if they changed its name or artist.
+func (s *Scanner) applyAlbumOverrides(key albumKey, album *db.Album) error {
+	if len(s.overrideAlbums[key]) == 0 {
+		return nil
+	}
+
+	for albumID := range s.overrideAlbums[key] {
+		if albumID == album.ID {
+			continue
+		}
+
+		for _, o := range s.albumOverrides[albumID] {
+			override := db.AlbumOverride{AlbumID: album.ID, Field: o.Field}
+			if err := s.db.AlbumOverrides.FirstOrCreate(&override); err != nil {
+				return err
 			}
 
-			ids := trackIDs[:max]
-			s.db.Exec("UPDATE tracks SET disc_id = ? WHERE id IN (?)", disc.ID, ids)
-			trackIDs = trackIDs[max:]
+			override.Value = o.Value
+			if err := s.db.AlbumOverrides.Update(&override); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// albumOverridesFor returns the overrides of the album, which are cached
+// for the rest of the scan.
+func (s *Scanner) albumOverridesFor(albumID string) ([]db.AlbumOverride, error) {
+	if albumID == "" {
+		return nil, nil
+	}
+
+	if overrides, ok := s.albumOverrides[albumID]; ok {
+		return overrides, nil
+	}
+
+	var overrides []db.AlbumOverride
+	if err := s.db.AlbumOverrides.Where("album_id = ?", albumID).All(&overrides); err != nil {
+		return nil, err
+	}
+	s.albumOverrides[albumID] = overrides
+
+	return overrides, nil
+}
+
+// lookupArtist returns the artist for the given key, creating it if it
+// hasn't been seen during this scan.
+func (s *Scanner) lookupArtist(artists map[artistKey]*db.Artist, key artistKey) (*db.Artist, error) {
+	artist := artists[key]
+	if artist == nil {
+		artist = &db.Artist{Name: key.Name}
+		if err := s.db.Artists.FirstOrCreate(artist); err != nil {
+			return nil, err
+		}
+		artists[key] = artist
+	}
+
+	return artist, nil
+}
+
+func (s *Scanner) updateTracks(column string, value string, trackIDs []string) error {
+	return eachChunk(trackIDs, func(ids []string) error {
+		return s.db.Exec("UPDATE tracks SET "+column+" = ? WHERE id IN (?)", value, ids)
+	})
+}
+
+// storeImage saves the image if it hasn't been seen before and
+// returns its ID. Images are deduplicated by their checksum.
+func (s *Scanner) storeImage(img *imageData) (string, error) {
+	if imageID := s.imageCache[img.Checksum]; imageID != "" {
+		return imageID, nil
+	}
+
+	palette := s.palettes.get(img.Checksum)
+
+	image := db.Image{
+		Checksum:      img.Checksum,
+		MIMEType:      img.MIMEType,
+		Width:         img.Width,
+		Height:        img.Height,
+		DominantColor: palette.Dominant,
+		VibrantColor:  palette.Vibrant,
+		MutedColor:    palette.Muted,
+	}
+	if err := s.db.Images.FirstOrCreate(&image); err != nil {
+		return "", err
+	}
+	s.imageCache[img.Checksum] = image.ID
+
+	// Images stored before dimensions and colors were recorded. The
+	// palette is only extracted for images that are missing it.
+	if (image.Width == 0 && img.Width != 0) || (image.DominantColor == "" && palette.Dominant != "") {
+		image.Width = img.Width
+		image.Height = img.Height
+		image.DominantColor = palette.Dominant
+		image.VibrantColor = palette.Vibrant
+		image.MutedColor = palette.Muted
+		if err := s.db.Images.Update(&image); err != nil {
+			return "", err
+		}
+	}
+
+	return image.ID, nil
+}
+
+// saveArtwork writes the image to the artwork store and drops its data so
+// a batch's images aren't all held in memory. Artwork left behind by a
+// rolled back batch is removed by the garbage collector.
+func (s *Scanner) saveArtwork(img *imageData) error {
+	if !s.savedArtwork[img.Checksum] {
+		if err := s.artworkStore.WriteImage(img.Checksum, img.Data); err != nil {
+			return err
 		}
+		s.savedArtwork[img.Checksum] = true
 	}
 
+	img.Data = nil
+
 	return nil
 }
 
-func (s *Scanner) scanBatch(fpaths []string) {
+// loadSidecarImage finds and saves the sidecar artwork of dir, if it
+// hasn't been loaded already.
+func (s *Scanner) loadSidecarImage(dir string) error {
+	if _, ok := s.sidecarImages[dir]; ok {
+		return nil
+	}
+
+	var img *imageData
+	if fpath := findSidecarArtwork(dir, s.config.ArtworkFilenames); fpath != "" {
+		if data, err := ioutil.ReadFile(fpath); err == nil {
+			img = newImageData(data)
+		}
+	}
+
+	if img != nil {
+		s.loadPalette(img)
+
+		if err := s.saveArtwork(img); err != nil {
+			return err
+		}
+	}
+
+	s.sidecarImages[dir] = img
+
+	return nil
+}
+
+func (s *Scanner) sidecarImageID(dir string) (string, error) {
+	if imageID, ok := s.sidecarCache[dir]; ok {
+		return imageID, nil
+	}
+
+	var imageID string
+	if img := s.sidecarImages[dir]; img != nil {
+		var err error
+		imageID, err = s.storeImage(img)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	s.sidecarCache[dir] = imageID
+
+	return imageID, nil
+}
+
+func (s *Scanner) addCredits(trackID string, role string, names []string) {
+	seen := make(map[string]bool)
+
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		key := creditKey{ArtistKey: artistKey{Name: name}, Role: role}
+		s.creditCache[key] = append(s.creditCache[key], trackID)
+	}
+}
+
+// batchFile is a file of a batch that needs to be written.
+type batchFile struct {
+	Metadata fileMetadata
+	// File is nil for files that haven't been scanned before
+	File *db.File
+	// Unchanged files only need their canonical path recorded
+	Unchanged bool
+	Result    *parseResult
+}
+
+type batch struct {
+	files   []batchFile
+	removed []string
+}
+
+// prepareBatch does the work for a batch that doesn't write to the
+// database: finding the files that changed, parsing them and saving their
+// artwork.
+func (s *Scanner) prepareBatch(fpaths []string, forced map[string]bool) (*batch, error) {
+	fpaths = expandArtworkPaths(fpaths, forced)
+
+	b := &batch{}
+
 	var metadata []fileMetadata
 	var inodes []uint64
 	for _, fpath := range fpaths {
 		var stat syscall.Stat_t
 		if err := syscall.Stat(fpath, &stat); err != nil {
+			if os.IsNotExist(err) {
+				b.removed = append(b.removed, fpath)
+			}
+			continue
+		}
+
+		var rootID string
+		if len(s.config.LibraryRoots) > 0 {
+			// Files outside of the library are removed in case they were
+			// scanned before their root was removed or an exclude
+			// pattern was added
+			root := libraryRootFor(s.config.LibraryRoots, fpath)
+			if root == nil || !rootIncludes(root, fpath) {
+				b.removed = append(b.removed, fpath)
+				continue
+			}
+
+			if root.Disabled {
+				continue
+			}
+
+			rootID = root.ID
+		}
+
+		if !isAudioFile(fpath) {
 			continue
 		}
 
@@ -162,16 +624,20 @@ func (s *Scanner) scanBatch(fpaths []string) {
 		}
 
 		metadata = append(metadata, fileMetadata{
-			Path:  fpath,
-			Inode: stat.Ino,
-			MTime: info.ModTime(),
+			Path:          fpath,
+			Inode:         stat.Ino,
+			Size:          info.Size(),
+			MTime:         info.ModTime(),
+			LibraryRootID: rootID,
 		})
 
 		inodes = append(inodes, stat.Ino)
 	}
 
 	var files []db.File
-	s.db.Files.Where("inode IN (?)", inodes).All(&files)
+	if err := s.db.Files.Where("inode IN (?)", inodes).All(&files); err != nil {
+		return nil, err
+	}
 
 	inodeFileMap := make(map[uint64]*db.File)
 
@@ -180,107 +646,503 @@ func (s *Scanner) scanBatch(fpaths []string) {
 		inodeFileMap[f.Inode] = f
 	}
 
+	// A file reachable through several paths is only scanned once per
+	// batch, through its canonical path if that's one of them, as batches
+	// are sorted by path rather than in the order they were walked
+	batchInodes := make(map[uint64]int)
+	for i := range metadata {
+		mdata := metadata[i]
+		if j, ok := batchInodes[mdata.Inode]; !ok ||
+			(metadata[j].Path != canonicalPath(metadata[j].Path) && mdata.Path == canonicalPath(mdata.Path)) {
+			batchInodes[mdata.Inode] = i
+		}
+	}
+
+	var pathsToParse []string
+	var parseIndexes []int
 	for i := range metadata {
 		mdata := metadata[i]
 		file := inodeFileMap[mdata.Inode]
 
+		if batchInodes[mdata.Inode] != i ||
+			(file != nil && file.Path != mdata.Path && isDuplicatePath(file, mdata.Path)) {
+			s.reportProgress(mdata.Path, nil)
+			continue
+		}
+
+		unchanged := file != nil &&
+			file.Path == mdata.Path &&
+			file.Size == mdata.Size &&
+			file.MTime.Equal(mdata.MTime) &&
+			file.LibraryRootID == mdata.LibraryRootID &&
+			!s.artworkChangedSince(filepath.Dir(mdata.Path), file.UpdatedAt)
+
+		if unchanged && !forced[mdata.Path] {
+			// Files scanned before canonical paths were recorded
+			if file.CanonicalPath == "" {
+				b.files = append(b.files, batchFile{Metadata: mdata, File: file, Unchanged: true})
+			}
+
+			s.reportProgress(mdata.Path, nil)
+			continue
+		}
+
+		parseIndexes = append(parseIndexes, len(b.files))
+		pathsToParse = append(pathsToParse, mdata.Path)
+		b.files = append(b.files, batchFile{Metadata: mdata, File: file})
+	}
+
+	err := s.parseFiles(pathsToParse, func(i int, res *parseResult) error {
+		b.files[parseIndexes[i]].Result = res
+
+		// Files that can't be parsed are skipped rather than failing the batch
+		if res.Err != nil {
+			s.reportProgress(pathsToParse[i], res.Err)
+			return nil
+		}
+
+		if res.Image != nil {
+			if err := s.saveArtwork(res.Image); err != nil {
+				return err
+			}
+		}
+
+		if err := s.loadSidecarImage(filepath.Dir(pathsToParse[i])); err != nil {
+			return err
+		}
+
+		s.reportProgress(pathsToParse[i], nil)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// writeBatch saves the batch's files and their tracks.
+func (s *Scanner) writeBatch(b *batch) error {
+	for i := range b.files {
+		f := &b.files[i]
+		mdata := f.Metadata
+		file := f.File
+
+		if f.Unchanged {
+			file.CanonicalPath = canonicalPath(mdata.Path)
+			if err := s.db.Files.Update(file); err != nil {
+				return err
+			}
+			continue
+		}
+
+		s.changed = true
+
 		if file == nil {
 			file = &db.File{
-				Path:  mdata.Path,
-				Inode: mdata.Inode,
-				MTime: mdata.MTime,
+				Path:          mdata.Path,
+				CanonicalPath: canonicalPath(mdata.Path),
+				Inode:         mdata.Inode,
+				Size:          mdata.Size,
+				MTime:         mdata.MTime,
+				LibraryRootID: mdata.LibraryRootID,
 			}
 
-			s.db.Files.Create(file)
-		} else if mdata.MTime.After(file.MTime) || mdata.Path != file.Path {
+			if err := s.db.Files.Create(file); err != nil {
+				return err
+			}
+		} else {
 			file.Path = mdata.Path
+			file.CanonicalPath = canonicalPath(mdata.Path)
+			file.Size = mdata.Size
 			file.MTime = mdata.MTime
-			s.db.Files.Update(file)
+			file.LibraryRootID = mdata.LibraryRootID
+			if err := s.db.Files.Update(file); err != nil {
+				return err
+			}
 		}
 
-		trackInfo, err := audio.ParseFile(mdata.Path)
-		if err != nil {
+		if f.Result.Err != nil {
 			continue
 		}
 
-		var imageID string
-		images := trackInfo.Images()
-		if len(images) > 0 {
-			img := images[0]
-
-			csum := md5.Sum(img)
-			csumStr := fmt.Sprintf("%x", csum[:])
-
-			imageID = s.imageCache[csumStr]
-			if imageID == "" {
-				_, imgType, err := image.Decode(bytes.NewReader(img))
-				if err == nil {
-					var mimeType string
-					switch imgType {
-					case "png":
-						mimeType = "image/png"
-					case "jpeg":
-						mimeType = "image/jpeg"
-					}
-
-					image := db.Image{Checksum: csumStr, MIMEType: mimeType}
-					s.db.Images.FirstOrCreate(&image)
-					imageID = image.ID
-					s.imageCache[csumStr] = imageID
-
-					s.artworkStore.WriteImage(csumStr, img)
-				}
-			}
+		if err := s.addTrack(file, f.Result); err != nil {
+			return err
+		}
+	}
+
+	// Removals are handled last so files moved within this batch have
+	// already been re-pointed to their new path.
+	return s.removeFiles(b.removed)
+}
+
+// canonicalPath returns fpath with every symlink resolved.
+func canonicalPath(fpath string) string {
+	if canonical, err := filepath.EvalSymlinks(fpath); err == nil {
+		return canonical
+	}
+
+	return fpath
+}
+
+// isDuplicatePath reports whether fpath is another path to file, found by
+// following symlinks, rather than where the file was moved to. The file
+// keeps its path unless fpath is its canonical path.
+func isDuplicatePath(file *db.File, fpath string) bool {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(file.Path, &stat); err != nil || stat.Ino != file.Inode {
+		return false
+	}
+
+	canonical := canonicalPath(fpath)
+
+	return fpath != canonical || file.Path == canonical
+}
+
+func (s *Scanner) reportProgress(fpath string, err error) {
+	if s.progress != nil {
+		s.progress(fpath, err)
+	}
+}
 
+func (s *Scanner) addTrack(file *db.File, res *parseResult) error {
+	trackInfo := res.Metadata
+	inferredFields := res.InferredFields
+
+	sidecarImageID, err := s.sidecarImageID(filepath.Dir(file.Path))
+	if err != nil {
+		return err
+	}
+
+	var imageID string
+	if res.Image != nil {
+		imageID, err = s.storeImage(res.Image)
+		if err != nil {
+			return err
 		}
+	}
 
-		var track db.Track
-		// TODO: Consider batch fetching these tracks
-		s.db.Tracks.Where("file_id = ?", file.ID).One(&track)
+	if imageID == "" {
+		imageID = sidecarImageID
+	}
 
-		track.FileID = file.ID
-		track.ImageID = imageID
-		track.Name = trackInfo.TrackName()
-		track.Position = trackInfo.TrackPosition()
-		track.TotalTracks = trackInfo.TotalTracks()
-		track.Duration = trackInfo.Duration()
-		track.ReleaseDate = trackInfo.ReleaseDate()
-		track.OriginalReleaseDate = trackInfo.OriginalReleaseDate()
+	// Directory-level artwork takes precedence for the album
+	albumImageID := sidecarImageID
+	if albumImageID == "" {
+		albumImageID = imageID
+	}
 
-		if track.ID != "" {
-			s.db.Tracks.Update(&track)
-		} else {
-			s.db.Tracks.Create(&track)
+	var track db.Track
+	// TODO: Consider batch fetching these tracks
+	s.db.Tracks.Where("file_id = ?", file.ID).One(&track)
+
+	// A new track takes over the overrides, plays and rating of a removed
+	// track of the same file
+	overridesTrackID, overridesAlbumID := track.ID, track.AlbumID
+	var removed *db.RemovedTrack
+	if track.ID == "" {
+		removed, err = s.removedTrack(file, trackInfo.Duration())
+		if err != nil {
+			return err
 		}
 
-		trackArtistKey := artistKey{Name: trackInfo.ArtistName()}
-		s.artistCacne[trackArtistKey] = append(s.artistCacne[trackArtistKey], track.ID)
+		if removed != nil {
+			overridesTrackID, overridesAlbumID = removed.TrackID, removed.AlbumID
+		}
+	}
+
+	var overriddenFields db.StringList
+	var overrideAlbumID string
+	if overridesTrackID != "" {
+		var overrides []db.Override
+		if err := s.db.Overrides.Where("track_id = ?", overridesTrackID).All(&overrides); err != nil {
+			return err
+		}
+
+		albumOverrides, err := s.albumOverridesFor(overridesAlbumID)
+		if err != nil {
+			return err
+		}
+		if len(albumOverrides) > 0 {
+			overrideAlbumID = overridesAlbumID
+		}
+
+		trackInfo, overriddenFields = applyOverrides(trackInfo, albumOverrides, overrides)
+		inferredFields = withoutFields(inferredFields, overriddenFields)
+	}
+
+	track.FileID = file.ID
+	track.ImageID = imageID
+	track.Name = trackInfo.TrackName()
+	track.Position = trackInfo.TrackPosition()
+	track.TotalTracks = trackInfo.TotalTracks()
+	track.Duration = trackInfo.Duration()
 
-		albumArtistKey := artistKey{Name: trackInfo.AlbumArtistName()}
-		s.albumArtistCache[albumArtistKey] = append(s.albumArtistCache[albumArtistKey], track.ID)
+	releaseDate := trackInfo.ReleaseDate()
+	track.ReleaseDate = releaseDate.Time
+	track.ReleaseDatePrecision = releaseDate.Precision
 
-		albumKey := albumKey{ArtistKey: albumArtistKey, Name: trackInfo.AlbumName()}
-		s.albumCache[albumKey] = append(s.albumCache[albumKey], track.ID)
+	originalReleaseDate := trackInfo.OriginalReleaseDate()
+	track.OriginalReleaseDate = originalReleaseDate.Time
+	track.OriginalReleaseDatePrecision = originalReleaseDate.Precision
 
-		if _, ok := s.albumModel[albumKey]; !ok {
-			s.albumModel[albumKey] = db.Album{
-				Name:                albumKey.Name,
-				ReleaseDate:         trackInfo.ReleaseDate(),
-				OriginalReleaseDate: trackInfo.OriginalReleaseDate(),
-				TotalDiscs:          trackInfo.TotalDiscs(),
-				ImageID:             imageID,
+	// work_id is assigned once the batch's works have been resolved
+	track.WorkID = ""
+	track.MovementName = trackInfo.MovementName()
+	track.MovementPosition = trackInfo.MovementPosition()
+	track.InferredFields = inferredFields
+	track.OverriddenFields = overriddenFields
+
+	if track.ID != "" {
+		err = s.db.Tracks.Update(&track)
+	} else {
+		err = s.db.Tracks.Create(&track)
+	}
+	if err != nil {
+		return err
+	}
+
+	if removed != nil {
+		if err := s.restoreRemovedTrack(removed, track.ID); err != nil {
+			return err
+		}
+	}
+
+	s.trackIDs = append(s.trackIDs, track.ID)
+
+	composers := trackInfo.Composers()
+	s.addCredits(track.ID, db.ComposerRole, composers)
+	s.addCredits(track.ID, db.ConductorRole, trackInfo.Conductors())
+	s.addCredits(track.ID, db.PerformerRole, trackInfo.Performers())
+
+	if workName := trackInfo.WorkName(); workName != "" {
+		var composerKey artistKey
+		if len(composers) > 0 {
+			composerKey = artistKey{Name: composers[0]}
+		}
+
+		workKey := workKey{ComposerKey: composerKey, Name: workName}
+		s.workCache[workKey] = append(s.workCache[workKey], track.ID)
+	}
+
+	trackArtistKey := artistKey{Name: trackInfo.ArtistName()}
+	s.artistCacne[trackArtistKey] = append(s.artistCacne[trackArtistKey], track.ID)
+
+	groupKey := albumGroupKey{
+		Dir:  filepath.Dir(file.Path),
+		Name: trackInfo.AlbumName(),
+	}
+
+	s.albumTracks[groupKey] = append(s.albumTracks[groupKey], albumTrack{
+		TrackID:           track.ID,
+		ArtistKey:         trackArtistKey,
+		AlbumArtistKey:    artistKey{Name: trackInfo.AlbumArtistName()},
+		AlbumArtistTagged: trackInfo.AlbumArtistName() != "" && !hasField(inferredFields, AlbumArtistField),
+		Compilation:       trackInfo.Compilation(),
+		OverrideAlbumID:   overrideAlbumID,
+		Album: db.Album{
+			Name:                         trackInfo.AlbumName(),
+			ReleaseDate:                  track.ReleaseDate,
+			ReleaseDatePrecision:         track.ReleaseDatePrecision,
+			OriginalReleaseDate:          track.OriginalReleaseDate,
+			OriginalReleaseDatePrecision: track.OriginalReleaseDatePrecision,
+			TotalDiscs:                   trackInfo.TotalDiscs(),
+			ImageID:                      albumImageID,
+		},
+		Disc: db.Disc{
+			Name:     trackInfo.DiscName(),
+			Position: trackInfo.DiscPosition(),
+		},
+	})
+
+	return nil
+}
+
+// isCompilation reports whether the tracks, which share a directory and
+// album name, make up a compilation. Tracks without an album artist tag are
+// also a compilation if they have different artists, or if they were
+// previously found to be one, as a rescan may only include some of them.
+func (s *Scanner) isCompilation(key albumGroupKey, tracks []albumTrack) (bool, error) {
+	// The compilation flag takes precedence over album artist tags
+	for _, t := range tracks {
+		if t.Compilation {
+			return true, nil
+		}
+	}
+
+	trackArtists := make(map[artistKey]bool)
+	for _, t := range tracks {
+		// An album artist inferred from the path doesn't rule out a
+		// compilation, since templates assume every album has one
+		if t.AlbumArtistTagged {
+			return false, nil
+		}
+
+		trackArtists[t.ArtistKey] = true
+	}
+
+	if len(trackArtists) > 1 {
+		return true, nil
+	}
+
+	var albums []db.Album
+	err := s.db.Albums.
+		Where("is_compilation = ? AND name = ? AND directory = ?", true, key.Name, key.Dir).
+		Limit(1).
+		All(&albums)
+
+	return len(albums) > 0, err
+}
+
+// groupAlbums assigns the scanned tracks to albums and discs.
+func (s *Scanner) groupAlbums() error {
+	variousArtistsKey := artistKey{Name: s.config.VariousArtistsName}
+	if variousArtistsKey.Name == "" {
+		variousArtistsKey.Name = DefaultVariousArtistsName
+	}
+
+	for groupKey, tracks := range s.albumTracks {
+		compilation, err := s.isCompilation(groupKey, tracks)
+		if err != nil {
+			return err
+		}
+
+		for _, t := range tracks {
+			key := albumKey{ArtistKey: t.AlbumArtistKey, Name: groupKey.Name}
+			if compilation {
+				key = albumKey{ArtistKey: variousArtistsKey, Name: groupKey.Name, Dir: groupKey.Dir}
+			}
+
+			s.albumArtistCache[key.ArtistKey] = append(s.albumArtistCache[key.ArtistKey], t.TrackID)
+
+			if t.OverrideAlbumID != "" {
+				if s.overrideAlbums[key] == nil {
+					s.overrideAlbums[key] = make(map[string]bool)
+				}
+				s.overrideAlbums[key][t.OverrideAlbumID] = true
+			}
+			s.albumCache[key] = append(s.albumCache[key], t.TrackID)
+
+			if album, ok := s.albumModel[key]; !ok {
+				album = t.Album
+				album.IsCompilation = compilation
+				album.Directory = key.Dir
+				s.albumModel[key] = album
+			} else if album.ImageID == "" && t.Album.ImageID != "" {
+				// Not every track may have embedded artwork
+				album.ImageID = t.Album.ImageID
+				s.albumModel[key] = album
+			}
+
+			discKey := discKey{AlbumKey: key, Position: t.Disc.Position}
+			s.discCache[discKey] = append(s.discCache[discKey], t.TrackID)
+
+			if _, ok := s.discModel[discKey]; !ok {
+				s.discModel[discKey] = t.Disc
 			}
 		}
+	}
 
-		discKey := discKey{AlbumKey: albumKey, Position: trackInfo.DiscPosition()}
-		s.discCache[discKey] = append(s.discCache[discKey], track.ID)
+	return nil
+}
+
+// removeFiles deletes the files, and their tracks, for paths that no longer
+// exist. A path may also refer to a removed directory.
+func (s *Scanner) removeFiles(fpaths []string) error {
+	for _, fpath := range fpaths {
+		dirPrefix := strings.TrimSuffix(fpath, "/") + "/"
 
-		if _, ok := s.discModel[discKey]; !ok {
-			s.discModel[discKey] = db.Disc{
-				Name:     trackInfo.DiscName(),
-				Position: trackInfo.DiscPosition(),
+		var files []db.File
+		err := s.db.Files.
+			Where("path = ? OR substr(path, 1, ?) = ?", fpath, len(dirPrefix), dirPrefix).
+			All(&files)
+		if err != nil {
+			return err
+		}
+
+		for i := range files {
+			if err := s.removeFile(&files[i]); err != nil {
+				return err
 			}
 		}
+	}
+
+	return nil
+}
 
+func (s *Scanner) removeFile(file *db.File) error {
+	s.changed = true
+
+	var tracks []db.Track
+	if err := s.db.Tracks.Where("file_id = ?", file.ID).All(&tracks); err != nil {
+		return err
 	}
+
+	for i := range tracks {
+		if err := s.db.Exec("DELETE FROM track_credits WHERE track_id = ?", tracks[i].ID); err != nil {
+			return err
+		}
+
+		// The track's overrides, plays and rating are kept in case the
+		// file reappears, and are garbage collected otherwise
+		removed := db.RemovedTrack{
+			TrackID:  tracks[i].ID,
+			AlbumID:  tracks[i].AlbumID,
+			Inode:    file.Inode,
+			Size:     file.Size,
+			Duration: tracks[i].Duration,
+		}
+		if err := s.db.RemovedTracks.Create(&removed); err != nil {
+			return err
+		}
+
+		if err := s.db.Tracks.Delete(&tracks[i]); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Files.Delete(file)
+}
+
+// maxDurationDifference is how many seconds the durations of the same file
+// may differ by, to allow for rounding
+const maxDurationDifference = 0.01
+
+// trackDataTables hold data about a track that isn't from its file.
+var trackDataTables = []string{"overrides", "plays", "ratings"}
+
+// removedTrack returns the most recently removed track of the file, if
+// any. Inodes are reused once files are deleted, so the removed file must
+// also have had the same size and duration to be the same file.
+func (s *Scanner) removedTrack(file *db.File, duration float64) (*db.RemovedTrack, error) {
+	var removed []db.RemovedTrack
+	err := s.db.RemovedTracks.
+		Where("inode = ? AND size = ?", file.Inode, file.Size).
+		Order("created_at", true).
+		All(&removed)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range removed {
+		if math.Abs(removed[i].Duration-duration) < maxDurationDifference {
+			return &removed[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// restoreRemovedTrack moves the removed track's data to the track that
+// replaced it.
+func (s *Scanner) restoreRemovedTrack(removed *db.RemovedTrack, trackID string) error {
+	for _, table := range trackDataTables {
+		err := s.db.Exec("UPDATE "+table+" SET track_id = ? WHERE track_id = ?", trackID, removed.TrackID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.db.Exec("DELETE FROM removed_tracks WHERE id = ?", removed.ID)
 }
@@ -1,7 +1,11 @@
 package scanner
 
 import (
+	"context"
+	"fmt"
+	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/cjlucas/tenor/artwork"
@@ -10,50 +14,113 @@ import (
 
 type Service struct {
 	db           *db.DB
-	artworkStore *artwork.Store
+	artworkStore artwork.Store
 
-	batchDelay time.Duration
-	batchSize  int
+	batchDelay     time.Duration
+	batchSize      int
+	followSymlinks bool
+	scannerConfig  ScannerConfig
 
-	scanFileChan chan string
+	scanFileChan chan scanRequest
+	// pendingFiles maps queued paths to whether they should be
+	// parsed even if unchanged
 	pendingFiles map[string]bool
 
 	scanner         *Scanner
 	scannerDoneChan chan interface{}
 
-	providers []Provider
+	// scanLock prevents garbage collection from running during a scan
+	scanLock sync.Mutex
+
+	providers     []Provider
+	providersLock sync.Mutex
+	providersWG   sync.WaitGroup
+
+	// ctx is done once the service is stopping
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	status *statusTracker
+	jobs   *jobTracker
+}
+
+type scanRequest struct {
+	Path  string
+	Force bool
 }
 
 type ServiceConfig struct {
 	BatchDelay time.Duration
 
 	MaxBatchSize int
+
+	// FollowSymlinks walks symlinked files and directories when
+	// rescanning paths
+	FollowSymlinks bool
+
+	Scanner ScannerConfig
 }
 
-func NewService(dal *db.DB, artworkStore *artwork.Store, cfg ServiceConfig) *Service {
+func NewService(dal *db.DB, artworkStore artwork.Store, cfg ServiceConfig) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &Service{
 		db:           dal,
 		artworkStore: artworkStore,
 
-		batchDelay: cfg.BatchDelay,
-		batchSize:  cfg.MaxBatchSize,
+		batchDelay:     cfg.BatchDelay,
+		batchSize:      cfg.MaxBatchSize,
+		followSymlinks: cfg.FollowSymlinks,
+		scannerConfig:  cfg.Scanner,
 
-		scanFileChan: make(chan string),
+		scanFileChan: make(chan scanRequest),
 		pendingFiles: make(map[string]bool),
 
 		scannerDoneChan: make(chan interface{}),
+
+		status: newStatusTracker(),
+		jobs:   newJobTracker(),
+
+		ctx:    ctx,
+		cancel: cancel,
 	}
 }
 
 func (s *Service) RegisterProvider(p Provider) {
+	s.providersLock.Lock()
 	s.providers = append(s.providers, p)
+	s.providersLock.Unlock()
+
 	p.SetHandler(s)
+	s.status.providerStarted(p)
+
+	s.providersWG.Add(1)
+	go func() {
+		defer s.providersWG.Done()
+		p.Run(s.ctx)
+	}()
+}
 
-	go p.Run()
+// enqueue drops the request if the service is stopping.
+func (s *Service) enqueue(req scanRequest) {
+	select {
+	case s.scanFileChan <- req:
+	case <-s.ctx.Done():
+	}
 }
 
 func (s *Service) ScanFile(fpath string) {
-	s.scanFileChan <- fpath
+	s.enqueue(scanRequest{Path: fpath})
+}
+
+func (s *Service) RescanFile(fpath string) {
+	s.enqueue(scanRequest{Path: fpath, Force: true})
+}
+
+// RemoveFile queues the path to be removed. Scans remove paths that no
+// longer exist, so there's no need to distinguish it from other changes.
+func (s *Service) RemoveFile(fpath string) {
+	s.enqueue(scanRequest{Path: fpath})
 }
 
 func (s *Service) processFiles() {
@@ -71,19 +138,110 @@ func (s *Service) processFiles() {
 	sort.Strings(fpaths)
 	fpaths = fpaths[:numFiles]
 
+	forced := make(map[string]bool)
 	for _, fpath := range fpaths {
+		if s.pendingFiles[fpath] {
+			forced[fpath] = true
+		}
 		delete(s.pendingFiles, fpath)
 	}
 
-	s.scanner = NewScanner(s.db, s.artworkStore)
+	s.scanner = NewScanner(s.db, s.artworkStore, s.scannerConfig)
+	s.scanner.progress = s.status.fileProcessed
+	s.status.batchStarted(len(fpaths), len(s.pendingFiles))
 
 	go func() {
-		s.scanner.Scan(fpaths)
+		s.scanLock.Lock()
+		err := s.scanner.Scan(fpaths, forced)
+		if err != nil {
+			fmt.Println("Error scanning batch:", err)
+		}
+		s.status.batchFinished(err)
+		s.jobs.filesScanned(fpaths)
+		if s.scanner.changed {
+			if _, err := collectGarbage(s.db, s.artworkStore); err != nil {
+				fmt.Println("Error collecting garbage:", err)
+			}
+		}
+		s.scanLock.Unlock()
+
 		s.scannerDoneChan <- nil
 	}()
 }
 
+// CollectGarbage removes orphaned rows and artwork. It waits for any
+// in-progress scan to finish.
+func (s *Service) CollectGarbage() (GCStats, error) {
+	s.scanLock.Lock()
+	defer s.scanLock.Unlock()
+
+	return collectGarbage(s.db, s.artworkStore)
+}
+
+// RescanPaths starts a job that rescans every file within the given paths,
+// including unchanged files, and returns the job's ID. Paths must be within
+// an enabled library root, if any are configured.
+func (s *Service) RescanPaths(paths []string) (string, error) {
+	roots := s.scannerConfig.LibraryRoots
+	for i, fpath := range paths {
+		paths[i] = filepath.Clean(fpath)
+
+		if len(roots) > 0 {
+			root := libraryRootFor(roots, paths[i])
+			if root == nil || root.Disabled {
+				return "", fmt.Errorf("%s is not in the library", fpath)
+			}
+		}
+	}
+
+	job := s.jobs.newJob()
+
+	s.RegisterProvider(&jobProvider{
+		Paths:          paths,
+		FollowSymlinks: s.followSymlinks,
+		jobs:           s.jobs,
+		job:            job,
+	})
+
+	return job.ID, nil
+}
+
+// RescanLibrary starts a job that rescans every enabled library root.
+func (s *Service) RescanLibrary() (string, error) {
+	var paths []string
+	for _, root := range s.scannerConfig.LibraryRoots {
+		if !root.Disabled {
+			paths = append(paths, root.Path)
+		}
+	}
+
+	return s.RescanPaths(paths)
+}
+
+// Job returns a snapshot of the job with the given ID. Finished jobs are
+// forgotten after a while.
+func (s *Service) Job(id string) (Job, bool) {
+	return s.jobs.Job(id)
+}
+
+// Status returns a snapshot of the scanner's progress.
+func (s *Service) Status() Status {
+	return s.status.Status()
+}
+
+// SubscribeStatus returns a channel that receives the scanner's Status
+// whenever it changes, starting with the current Status. The returned func
+// must be called once the caller is no longer reading from the channel.
+func (s *Service) SubscribeStatus() (<-chan Status, func()) {
+	return s.status.Subscribe()
+}
+
 func (s *Service) DeregisterProvider(p Provider) {
+	s.status.providerFinished(p)
+
+	s.providersLock.Lock()
+	defer s.providersLock.Unlock()
+
 	for i := range s.providers {
 		if s.providers[i] == p {
 			providers := append(s.providers[:i])
@@ -97,15 +255,22 @@ func (s *Service) DeregisterProvider(p Provider) {
 	}
 }
 
-func (s *Service) Run() {
+// Run processes queued files until ctx is done. It then stops the providers
+// and returns once they and the in-progress batch, if any, have finished.
+// Files that are still queued are dropped.
+func (s *Service) Run(ctx context.Context) {
 	for {
 		select {
-		case <-time.Tick(s.batchDelay):
+		case <-ctx.Done():
+			s.stop()
+			return
+		case <-time.After(s.batchDelay):
 			if s.scanner == nil && len(s.pendingFiles) > 0 {
 				s.processFiles()
 			}
-		case fpath := <-s.scanFileChan:
-			s.pendingFiles[fpath] = true
+		case req := <-s.scanFileChan:
+			s.pendingFiles[req.Path] = s.pendingFiles[req.Path] || req.Force
+			s.status.setPending(len(s.pendingFiles))
 		case <-s.scannerDoneChan:
 			s.scanner = nil
 			if len(s.pendingFiles) > 0 {
@@ -114,3 +279,14 @@ func (s *Service) Run() {
 		}
 	}
 }
+
+func (s *Service) stop() {
+	s.cancel()
+
+	if s.scanner != nil {
+		<-s.scannerDoneChan
+		s.scanner = nil
+	}
+
+	s.providersWG.Wait()
+}
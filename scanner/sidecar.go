@@ -0,0 +1,117 @@
+package scanner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var DefaultArtworkFilenames = []string{"cover.*", "folder.*", "front.*"}
+
+func isImageFile(fpath string) bool {
+	ext := strings.ToLower(path.Ext(fpath))
+
+	return ext == ".jpg" || ext == ".jpeg" || ext == ".png"
+}
+
+// findSidecarArtwork returns the path of the image in dir matching the
+// highest priority pattern, or an empty string if none match.
+// Patterns are matched case insensitively.
+func findSidecarArtwork(dir string, patterns []string) string {
+	if len(patterns) == 0 {
+		return ""
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+
+		for _, info := range infos {
+			name := info.Name()
+			if info.IsDir() || !isImageFile(name) {
+				continue
+			}
+
+			if ok, _ := filepath.Match(pattern, strings.ToLower(name)); ok {
+				return filepath.Join(dir, name)
+			}
+		}
+	}
+
+	return ""
+}
+
+// artworkChangedSince reports whether the sidecar artwork of dir may have
+// been added, replaced or removed since t, such as while the scanner wasn't
+// running. Adding or removing a file changes the directory's mtime, so a
+// new track also causes the rest of its directory to be rescanned.
+func (s *Scanner) artworkChangedSince(dir string, t time.Time) bool {
+	if len(s.config.ArtworkFilenames) == 0 {
+		return false
+	}
+
+	mtime, ok := s.artworkMTimes[dir]
+	if !ok {
+		if info, err := os.Stat(dir); err == nil {
+			mtime = info.ModTime()
+		}
+
+		if fpath := findSidecarArtwork(dir, s.config.ArtworkFilenames); fpath != "" {
+			if info, err := os.Stat(fpath); err == nil && info.ModTime().After(mtime) {
+				mtime = info.ModTime()
+			}
+		}
+
+		s.artworkMTimes[dir] = mtime
+	}
+
+	return mtime.After(t)
+}
+
+// expandArtworkPaths replaces any image paths with the audio files in the
+// same directory, so a change to sidecar artwork rescans its album. The
+// audio files are added to forced as they're unchanged themselves.
+func expandArtworkPaths(fpaths []string, forced map[string]bool) []string {
+	seen := make(map[string]bool)
+	var out []string
+
+	add := func(fpath string) {
+		if !seen[fpath] {
+			seen[fpath] = true
+			out = append(out, fpath)
+		}
+	}
+
+	for _, fpath := range fpaths {
+		if !isImageFile(fpath) {
+			add(fpath)
+			continue
+		}
+
+		dir := filepath.Dir(fpath)
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, info := range infos {
+			if !info.IsDir() && isAudioFile(info.Name()) {
+				fpath := filepath.Join(dir, info.Name())
+				forced[fpath] = true
+				add(fpath)
+			}
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
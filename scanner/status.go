@@ -0,0 +1,220 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scanner states
+const (
+	IdleState     = "idle"
+	ScanningState = "scanning"
+)
+
+// Provider states
+const (
+	ProviderRunningState  = "running"
+	ProviderFinishedState = "finished"
+)
+
+type ProviderStatus struct {
+	Name  string
+	State string
+}
+
+// Status is a snapshot of the scanner's progress. Counts are reset each
+// time the scanner starts after being idle.
+type Status struct {
+	State string
+
+	// Queued is the number of files waiting to be scanned
+	Queued    int
+	Processed int
+	Failed    int
+
+	CurrentPath string
+
+	// ETA is the estimated time until the queue is empty, or zero
+	// if it can't be estimated yet.
+	ETA time.Duration
+
+	StartedAt time.Time
+
+	Providers []ProviderStatus
+}
+
+func (s Status) copy() Status {
+	s.Providers = append([]ProviderStatus(nil), s.Providers...)
+	return s
+}
+
+func providerName(p Provider) string {
+	name := fmt.Sprintf("%T", p)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// statusTracker holds the current Status and publishes every change to
+// its subscribers. It's safe for concurrent use.
+type statusTracker struct {
+	lock   sync.Mutex
+	status Status
+
+	// batchSize and batchProcessed track the in-progress batch,
+	// which is no longer in the service's pending files
+	batchSize      int
+	batchProcessed int
+	pending        int
+
+	// providers parallels status.Providers
+	providers   []Provider
+	subscribers map[chan Status]bool
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{
+		status:      Status{State: IdleState},
+		subscribers: make(map[chan Status]bool),
+	}
+}
+
+func (t *statusTracker) Status() Status {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.status.copy()
+}
+
+// Subscribe returns a channel that receives the latest Status whenever
+// it changes. Slow subscribers only receive the most recent Status.
+// The returned func must be called to unsubscribe.
+func (t *statusTracker) Subscribe() (<-chan Status, func()) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	c := make(chan Status, 1)
+	c <- t.status.copy()
+	t.subscribers[c] = true
+
+	return c, func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		delete(t.subscribers, c)
+	}
+}
+
+// update calls fn with the current Status and publishes the result.
+func (t *statusTracker) update(fn func(status *Status)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	fn(&t.status)
+
+	status := &t.status
+	status.Queued = t.pending + t.batchSize - t.batchProcessed
+	if status.Queued < 0 {
+		status.Queued = 0
+	}
+
+	status.ETA = 0
+	if status.State == ScanningState && status.Processed > 0 {
+		perFile := time.Since(status.StartedAt) / time.Duration(status.Processed)
+		status.ETA = perFile * time.Duration(status.Queued)
+	}
+
+	for c := range t.subscribers {
+		// Replace the Status the subscriber hasn't received yet
+		select {
+		case <-c:
+		default:
+		}
+
+		c <- status.copy()
+	}
+}
+
+func (t *statusTracker) setPending(n int) {
+	t.update(func(status *Status) {
+		t.pending = n
+	})
+}
+
+func (t *statusTracker) batchStarted(size int, pending int) {
+	t.update(func(status *Status) {
+		if status.State == IdleState {
+			status.State = ScanningState
+			status.Processed = 0
+			status.Failed = 0
+			status.StartedAt = time.Now()
+		}
+
+		t.batchSize = size
+		t.batchProcessed = 0
+		t.pending = pending
+	})
+}
+
+func (t *statusTracker) fileProcessed(fpath string, err error) {
+	t.update(func(status *Status) {
+		t.batchProcessed++
+		status.Processed++
+		if err != nil {
+			status.Failed++
+		}
+		status.CurrentPath = fpath
+	})
+}
+
+// batchFinished marks the remaining files in the batch as failed if the
+// batch returned an error.
+func (t *statusTracker) batchFinished(err error) {
+	t.update(func(status *Status) {
+		if err != nil && t.batchProcessed < t.batchSize {
+			status.Failed += t.batchSize - t.batchProcessed
+		}
+
+		t.batchSize = 0
+		t.batchProcessed = 0
+		status.CurrentPath = ""
+
+		if t.pending == 0 {
+			status.State = IdleState
+
+			// Forget providers that have finished once they no
+			// longer have any files to scan
+			var providers []Provider
+			var statuses []ProviderStatus
+			for i, p := range status.Providers {
+				if p.State != ProviderFinishedState {
+					providers = append(providers, t.providers[i])
+					statuses = append(statuses, p)
+				}
+			}
+			t.providers = providers
+			status.Providers = statuses
+		}
+	})
+}
+
+func (t *statusTracker) providerStarted(p Provider) {
+	t.update(func(status *Status) {
+		t.providers = append(t.providers, p)
+		status.Providers = append(status.Providers, ProviderStatus{
+			Name:  providerName(p),
+			State: ProviderRunningState,
+		})
+	})
+}
+
+func (t *statusTracker) providerFinished(p Provider) {
+	t.update(func(status *Status) {
+		for i := range t.providers {
+			if t.providers[i] == p {
+				status.Providers[i].State = ProviderFinishedState
+				break
+			}
+		}
+	})
+}
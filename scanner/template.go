@@ -0,0 +1,226 @@
+package scanner
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cjlucas/tenor/audio"
+	"github.com/cjlucas/tenor/date"
+	"github.com/cjlucas/tenor/db"
+)
+
+// Fields that can be referenced in a path template
+const (
+	TitleField       = "title"
+	TrackField       = "track"
+	ArtistField      = "artist"
+	AlbumArtistField = "albumartist"
+	AlbumField       = "album"
+	YearField        = "year"
+	DiscField        = "disc"
+)
+
+var templateFieldPatterns = map[string]string{
+	TitleField:       `[^/]+?`,
+	TrackField:       `\d+`,
+	ArtistField:      `[^/]+?`,
+	AlbumArtistField: `[^/]+?`,
+	AlbumField:       `[^/]+?`,
+	YearField:        `\d{4}`,
+	DiscField:        `\d+`,
+}
+
+var templateFieldRegexp = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// PathTemplate describes a library layout, such as
+// "{albumartist}/{year} - {album}/{disc}-{track} {title}", used to infer
+// metadata from the path of files that are missing tags. Templates are
+// matched against the end of a file's path, without its extension.
+type PathTemplate struct {
+	Template string
+
+	re *regexp.Regexp
+}
+
+func ParsePathTemplate(template string) (*PathTemplate, error) {
+	var pattern string
+
+	matches := templateFieldRegexp.FindAllStringSubmatchIndex(template, -1)
+	offset := 0
+	for _, m := range matches {
+		field := template[m[2]:m[3]]
+		fieldPattern, ok := templateFieldPatterns[field]
+		if !ok {
+			return nil, fmt.Errorf("unknown template field: %s", field)
+		}
+
+		pattern += regexp.QuoteMeta(template[offset:m[0]])
+		pattern += "(?P<" + field + ">" + fieldPattern + ")"
+		offset = m[1]
+	}
+	pattern += regexp.QuoteMeta(template[offset:])
+
+	re, err := regexp.Compile("(?:^|/)" + pattern + "$")
+	if err != nil {
+		return nil, err
+	}
+
+	return &PathTemplate{Template: template, re: re}, nil
+}
+
+func MustParsePathTemplate(template string) *PathTemplate {
+	t, err := ParsePathTemplate(template)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+// Match returns the field values extracted from fpath, or nil if
+// fpath doesn't match the template.
+func (t *PathTemplate) Match(fpath string) map[string]string {
+	fpath = strings.TrimSuffix(fpath, path.Ext(fpath))
+
+	m := t.re.FindStringSubmatch(fpath)
+	if m == nil {
+		return nil
+	}
+
+	fields := make(map[string]string)
+	for i, name := range t.re.SubexpNames() {
+		if name != "" && fields[name] == "" {
+			fields[name] = strings.TrimSpace(m[i])
+		}
+	}
+
+	return fields
+}
+
+// fieldMetadata replaces fields of the wrapped Metadata, keyed by the
+// template field names. It holds the values inferred from a PathTemplate
+// as well as user overrides.
+type fieldMetadata struct {
+	audio.Metadata
+
+	fields map[string]string
+}
+
+// inferMetadata returns metadata using the first template matching fpath,
+// along with the list of fields that were inferred.
+func inferMetadata(metadata audio.Metadata, fpath string, templates []*PathTemplate) (audio.Metadata, db.StringList) {
+	var fields map[string]string
+	for _, t := range templates {
+		if fields = t.Match(fpath); fields != nil {
+			break
+		}
+	}
+
+	if fields == nil {
+		return metadata, nil
+	}
+
+	// The track artist is usually the album artist if it's not in the path
+	if fields[ArtistField] == "" {
+		fields[ArtistField] = fields[AlbumArtistField]
+	}
+
+	tagged := map[string]bool{
+		TitleField:       metadata.TrackName() != "",
+		TrackField:       metadata.TrackPosition() != 0,
+		ArtistField:      metadata.ArtistName() != "",
+		AlbumArtistField: metadata.AlbumArtistName() != "",
+		AlbumField:       metadata.AlbumName() != "",
+		YearField:        !metadata.ReleaseDate().IsZero(),
+		DiscField:        metadata.DiscPosition() != 0,
+	}
+
+	inferred := &fieldMetadata{
+		Metadata: metadata,
+		fields:   make(map[string]string),
+	}
+
+	var inferredFields db.StringList
+	for field, value := range fields {
+		if value != "" && !tagged[field] {
+			inferred.fields[field] = value
+			inferredFields = append(inferredFields, field)
+		}
+	}
+
+	if len(inferredFields) == 0 {
+		return metadata, nil
+	}
+
+	sort.Strings(inferredFields)
+
+	return inferred, inferredFields
+}
+
+func (m *fieldMetadata) intField(field string) (int, bool) {
+	n, err := strconv.Atoi(m.fields[field])
+
+	return n, err == nil
+}
+
+func (m *fieldMetadata) TrackName() string {
+	if s, ok := m.fields[TitleField]; ok {
+		return s
+	}
+
+	return m.Metadata.TrackName()
+}
+
+func (m *fieldMetadata) TrackPosition() int {
+	if n, ok := m.intField(TrackField); ok {
+		return n
+	}
+
+	return m.Metadata.TrackPosition()
+}
+
+func (m *fieldMetadata) ArtistName() string {
+	if s, ok := m.fields[ArtistField]; ok {
+		return s
+	}
+
+	return m.Metadata.ArtistName()
+}
+
+func (m *fieldMetadata) AlbumArtistName() string {
+	if s, ok := m.fields[AlbumArtistField]; ok {
+		return s
+	}
+
+	return m.Metadata.AlbumArtistName()
+}
+
+func (m *fieldMetadata) AlbumName() string {
+	if s, ok := m.fields[AlbumField]; ok {
+		return s
+	}
+
+	return m.Metadata.AlbumName()
+}
+
+func (m *fieldMetadata) ReleaseDate() date.Date {
+	if year, ok := m.intField(YearField); ok {
+		t := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		return date.New(t, date.Year)
+	}
+
+	return m.Metadata.ReleaseDate()
+}
+
+func (m *fieldMetadata) DiscPosition() int {
+	if n, ok := m.intField(DiscField); ok {
+		return n
+	}
+
+	return m.Metadata.DiscPosition()
+}
@@ -0,0 +1,123 @@
+package scanner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+type devIno struct {
+	Dev uint64
+	Ino uint64
+}
+
+// walk calls fn for each file and directory within root, like
+// filepath.Walk. If followSymlinks is set, symlinks are walked as the file
+// or directory they point to, under the symlink's path.
+//
+// Symlinked directories are walked after everything else, so files are
+// found under their real path where possible. Each directory is only
+// walked once, however many paths lead to it, which also stops loops.
+func walk(root string, followSymlinks bool, fn filepath.WalkFunc) error {
+	if !followSymlinks {
+		return filepath.Walk(root, fn)
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+
+	w := symlinkWalker{
+		fn:      fn,
+		visited: make(map[devIno]bool),
+	}
+
+	if err := w.walk(root, info); err != nil && err != filepath.SkipDir {
+		return err
+	}
+
+	for len(w.symlinkedDirs) > 0 {
+		fpath := w.symlinkedDirs[0]
+		w.symlinkedDirs = w.symlinkedDirs[1:]
+
+		info, err := os.Stat(fpath)
+		if err != nil {
+			continue
+		}
+
+		if err := w.walk(fpath, info); err != nil && err != filepath.SkipDir {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type symlinkWalker struct {
+	fn            filepath.WalkFunc
+	visited       map[devIno]bool
+	symlinkedDirs []string
+}
+
+func (w *symlinkWalker) walk(fpath string, info os.FileInfo) error {
+	if !info.IsDir() {
+		return w.fn(fpath, info, nil)
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		key := devIno{Dev: uint64(stat.Dev), Ino: stat.Ino}
+		if w.visited[key] {
+			return nil
+		}
+		w.visited[key] = true
+	}
+
+	if err := w.fn(fpath, info, nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(fpath)
+	if err != nil {
+		if err := w.fn(fpath, info, err); err != nil && err != filepath.SkipDir {
+			return err
+		}
+		return nil
+	}
+
+	for _, entry := range entries {
+		child := filepath.Join(fpath, entry.Name())
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Stat(child)
+			if err != nil {
+				// Broken symlinks are passed to fn with the error
+				if err := w.fn(child, entry, err); err != nil && err != filepath.SkipDir {
+					return err
+				}
+				continue
+			}
+
+			if target.IsDir() {
+				w.symlinkedDirs = append(w.symlinkedDirs, child)
+				continue
+			}
+
+			entry = target
+		}
+
+		// Only files return SkipDir here, which skips the rest of the
+		// directory like filepath.Walk
+		if err := w.walk(child, entry); err == filepath.SkipDir {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
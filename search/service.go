@@ -8,6 +8,8 @@ import (
 )
 
 type Service struct {
+	db *db.DB
+
 	artistsTrie *Trie
 	albumsTrie  *Trie
 	tracksTrie  *Trie
@@ -15,6 +17,7 @@ type Service struct {
 
 func NewService(dal *db.DB) *Service {
 	service := &Service{
+		db:          dal,
 		artistsTrie: buildSearchTrie(dal, &dal.AlbumArtists.Collection, db.Artist{}),
 		albumsTrie:  buildSearchTrie(dal, &dal.Albums.Collection, db.Album{}),
 		tracksTrie:  buildSearchTrie(dal, &dal.Tracks.Collection, db.Track{}),
@@ -25,6 +28,11 @@ func NewService(dal *db.DB) *Service {
 	return service
 }
 
+// Close stops the service from receiving changes to the database.
+func (s *Service) Close() {
+	s.db.Deregister(s)
+}
+
 func buildSearchTrie(db *db.DB, coll *db.Collection, model interface{}) *Trie {
 	modelType := reflect.TypeOf(model)
 	for modelType.Kind() == reflect.Ptr {
@@ -90,15 +98,21 @@ func (s *Service) SearchTracks(query string) []string {
 
 func (s *Service) ArtistChanged(artist *db.Artist, eventType db.EventType) {
 	s.artistsTrie.DeleteValue(artist.ID)
-	addModel(s.artistsTrie, artist)
+	if eventType != db.Deleted {
+		addModel(s.artistsTrie, artist)
+	}
 }
 
 func (s *Service) AlbumChanged(album *db.Album, eventType db.EventType) {
 	s.albumsTrie.DeleteValue(album.ID)
-	addModel(s.albumsTrie, album)
+	if eventType != db.Deleted {
+		addModel(s.albumsTrie, album)
+	}
 }
 
 func (s *Service) TrackChanged(track *db.Track, eventType db.EventType) {
 	s.tracksTrie.DeleteValue(track.ID)
-	addModel(s.tracksTrie, track)
+	if eventType != db.Deleted {
+		addModel(s.tracksTrie, track)
+	}
 }
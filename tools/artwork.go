@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cjlucas/tenor/artwork"
+)
+
+func main() {
+	from := flag.String("from", ".images", "directory or s3:// URL to copy artwork from")
+	to := flag.String("to", "", "directory or s3:// URL to copy artwork to")
+	flag.Parse()
+
+	if *to == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	src, err := artwork.OpenStore(*from)
+	if err != nil {
+		panic(err)
+	}
+
+	dst, err := artwork.OpenStore(*to)
+	if err != nil {
+		panic(err)
+	}
+
+	copied, err := artwork.Copy(dst, src)
+	fmt.Printf("Copied %d images\n", copied)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cjlucas/tenor/db"
+	"github.com/cjlucas/tenor/importer"
+)
+
+func main() {
+	var rewrites importer.PathRewrites
+
+	dbPath := flag.String("db", "dev.db", "path to the tenor database")
+	libraryPath := flag.String("library", "", "path to the iTunes or Music Library.xml")
+	dryRun := flag.Bool("dry-run", false, "report matches without importing")
+	flag.Var(&rewrites, "rewrite", "replace a path prefix, as old=new (repeatable)")
+	flag.Parse()
+
+	if *libraryPath == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	dal, err := db.Open(*dbPath)
+	if err != nil {
+		panic(err)
+	}
+	defer dal.Close()
+
+	f, err := os.Open(*libraryPath)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	imp := importer.ITunesImporter{
+		DB:       dal,
+		Rewrites: rewrites,
+		DryRun:   *dryRun,
+	}
+
+	report, err := imp.Import(f)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, entry := range report.Unmatched {
+		fmt.Println("Unmatched:", entry)
+	}
+
+	fmt.Printf("Entries: %d\n", report.Total)
+	fmt.Printf("Matched by path: %d\n", report.MatchedByPath)
+	fmt.Printf("Matched by tags: %d\n", report.MatchedByTags)
+	fmt.Printf("Unmatched: %d\n", len(report.Unmatched))
+}
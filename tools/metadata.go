@@ -23,8 +23,15 @@ func main() {
 		fmt.Printf("ArtistName: %s\n", metadata.ArtistName())
 		fmt.Printf("AlbumArtistName: %s\n", metadata.AlbumArtistName())
 		fmt.Printf("AlbumName: %s\n", metadata.AlbumName())
-		fmt.Printf("ReleaseDate: %v\n", metadata.ReleaseDate())
-		fmt.Printf("OriginalReleaseDate: %v\n", metadata.OriginalReleaseDate())
+		fmt.Printf("ReleaseDate: %s\n", metadata.ReleaseDate())
+		fmt.Printf("OriginalReleaseDate: %s\n", metadata.OriginalReleaseDate())
+		fmt.Printf("Composers: %v\n", metadata.Composers())
+		fmt.Printf("Conductors: %v\n", metadata.Conductors())
+		fmt.Printf("Performers: %v\n", metadata.Performers())
+		fmt.Printf("WorkName: %s\n", metadata.WorkName())
+		fmt.Printf("MovementName: %s\n", metadata.MovementName())
+		fmt.Printf("MovementPosition: %d\n", metadata.MovementPosition())
+		fmt.Printf("Compilation: %t\n", metadata.Compilation())
 		fmt.Printf("Duration: %f\n", metadata.Duration())
 	}
 }